@@ -67,36 +67,40 @@ func main() {
     pc := 0
     for {
         select {
-        case <-conn.Open:
-            opened = true
-            fmt.Println("ws open")
-        case p := <-conn.Packets:
-            if p != nil {
+        case ev, ok := <-conn.Events():
+            if !ok { return }
+            switch e := ev.(type) {
+            case fa.OpenedEvent:
+                opened = true
+                fmt.Println("ws open")
+            case fa.OpusPacketEvent:
                 pc++
                 if pc%50 == 0 { fmt.Println("opus packets:", pc) }
-            }
-        case a := <-conn.Audio:
-            if _, err := out.Write(a); err != nil { fmt.Println("write err:", err) }
-            if ffplayStdin != nil { _, _ = ffplayStdin.Write(a) }
-        case err := <-conn.Error:
-            fmt.Println("ws error:", err)
-            return
-        case <-conn.Close:
-            fmt.Println("ws close")
-            if ffplayStdin != nil { _ = ffplayStdin.Close() }
-            if ffplayCmd != nil { _ = ffplayCmd.Wait() }
-            if opened { fmt.Println("written out_rt." + format) }
-            if ffplayCmd == nil && format == "mp3" {
-                if path, err := exec.LookPath("afplay"); err == nil {
-                    cmd := exec.Command(path, "out_rt." + format)
-                    cmd.Stdout = io.Discard
-                    cmd.Stderr = io.Discard
-                    _ = cmd.Run()
+            case fa.AudioEvent:
+                if _, err := out.Write(e.Data); err != nil { fmt.Println("write err:", err) }
+                if ffplayStdin != nil { _, _ = ffplayStdin.Write(e.Data) }
+            case fa.ErrorEvent:
+                fmt.Println("ws error:", e.Err)
+                return
+            case fa.FinishedEvent:
+                fmt.Println("ws close")
+                conn.Release()
+                if ffplayStdin != nil { _ = ffplayStdin.Close() }
+                if ffplayCmd != nil { _ = ffplayCmd.Wait() }
+                if opened { fmt.Println("written out_rt." + format) }
+                if ffplayCmd == nil && format == "mp3" {
+                    if path, err := exec.LookPath("afplay"); err == nil {
+                        cmd := exec.Command(path, "out_rt." + format)
+                        cmd.Stdout = io.Discard
+                        cmd.Stderr = io.Discard
+                        _ = cmd.Run()
+                    }
                 }
+                return
             }
-            return
         case <-sig:
             fmt.Println("signal received, exit")
+            conn.ForceClose()
             return
         case <-ctx.Done():
             fmt.Println("timeout")
@@ -48,7 +48,7 @@ func runTwoPhases(c *fa.Client, req fa.TTSRequest, backend, outfile string, a []
     dialStart := time.Now()
     conn, err := c.ConvertRealtime(ctx, req, texts, backend)
     if err != nil { return err }
-    <-conn.Open
+    if _, ok := (<-conn.Events()).(fa.OpenedEvent); !ok { return fmt.Errorf("session did not open") }
     fmt.Printf("connected in %dms\n", time.Since(dialStart).Milliseconds())
     out, err := os.Create(outfile)
     if err != nil { return err }
@@ -62,22 +62,12 @@ func runTwoPhases(c *fa.Client, req fa.TTSRequest, backend, outfile string, a []
         for _, s := range b { texts <- s; j := time.Duration(r.Intn(200)) * time.Millisecond; time.Sleep(300*time.Millisecond + j) }
         close(texts)
     }()
-    for {
-        select {
-        case a := <-conn.Audio:
-            if playerIn != nil { _, _ = playerIn.Write(a) }
-            _, _ = out.Write(a)
-        case e := <-conn.Error:
-            conn.ForceClose()
-            return e
-        case <-conn.DoneCh():
-            return nil
-        case <-ctx.Done():
-            conn.Stop()
-            conn.Release()
-            return ctx.Err()
-        }
-    }
+    var dst io.Writer = out
+    if playerIn != nil { dst = io.MultiWriter(out, playerIn) }
+    r := conn.AudioReader()
+    defer r.Close()
+    _, err = io.Copy(dst, r)
+    return err
 }
 
 func main() {
@@ -0,0 +1,106 @@
+package fishaudio
+
+import (
+    "errors"
+    "unicode/utf8"
+)
+
+var ErrQueueFull = errors.New("realtime send queue full")
+
+// OverflowPolicy decides what Send does when Options.SendQueueLimit texts are
+// already waiting to be written.
+type OverflowPolicy int
+
+const (
+    // OverflowBlock makes Send wait until a text has been written.
+    OverflowBlock OverflowPolicy = iota
+    // OverflowDropOldest drops the oldest waiting text and reports it with an
+    // UtteranceDroppedEvent.
+    OverflowDropOldest
+    // OverflowError makes Send return ErrQueueFull.
+    OverflowError
+)
+
+// TextCounts are running totals, in characters, of the texts of a session:
+// accepted by Send, written, flushed, and confirmed once the server answered
+// their flush, counted per text as for Result.Utterances. Unconfirmed counts
+// flushed texts the session ended or restarted without an answer for. Flushed minus Confirmed and Unconfirmed is how far
+// synthesis is behind the input.
+type TextCounts struct {
+    Queued      int64
+    Sent        int64
+    Flushed     int64
+    Confirmed   int64
+    Unconfirmed int64
+    Dropped     int64
+    Cancelled   int64
+}
+
+// UtteranceDroppedEvent reports a queued text discarded by OverflowDropOldest.
+// ID is zero for a text from the texts channel of ConvertRealtime that Send
+// refused, with ErrQueueFull or after End; such a text was never queued and is
+// not part of TextCounts.
+type UtteranceDroppedEvent struct {
+    ID   UtteranceID
+    Text string
+}
+
+func (UtteranceDroppedEvent) realtimeEvent() {}
+
+// UtteranceUnconfirmedEvent reports a text the server finished without
+// completing, or that was still waiting for audio when the session ended.
+type UtteranceUnconfirmedEvent struct {
+    ID   UtteranceID
+    Text string
+}
+
+func (UtteranceUnconfirmedEvent) realtimeEvent() {}
+
+// TextCounts returns the session's text counters.
+func (c *RealtimeConnection) TextCounts() TextCounts {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.counts
+}
+
+// queued returns the number of texts waiting to be written; the caller holds c.mu.
+func (c *RealtimeConnection) queued() int {
+    n := 0
+    for _, u := range c.queue { if !u.stop { n++ } }
+    return n
+}
+
+// refused reports a text from the texts channel that Send did not accept.
+func (c *RealtimeConnection) refused(t string) {
+    c.mu.Lock()
+    c.notices = append(c.notices, UtteranceDroppedEvent{Text: t})
+    c.mu.Unlock()
+    select {
+    case c.kick <- struct{}{}:
+    default:
+    }
+}
+
+// dropOldest removes the oldest waiting text; the caller holds c.mu.
+func (c *RealtimeConnection) dropOldest() {
+    for i, u := range c.queue {
+        if u.stop { continue }
+        c.queue = append(c.queue[:i:i], c.queue[i+1:]...)
+        c.counts.Dropped += int64(utf8.RuneCountInString(u.text))
+        c.notices = append(c.notices, UtteranceDroppedEvent{ID: u.id, Text: u.text})
+        return
+    }
+}
+
+// unconfirm counts an utterance that ends without complete audio; the caller
+// holds c.mu.
+func (c *RealtimeConnection) unconfirm(u *utterance) Event {
+    c.counts.Unconfirmed += int64(utf8.RuneCountInString(u.text))
+    return UtteranceUnconfirmedEvent{ID: u.id, Text: u.text}
+}
+
+// confirm counts an utterance whose audio has completed; the caller holds c.mu.
+func (c *RealtimeConnection) confirm(u *utterance) {
+    c.completedN++
+    c.counts.Confirmed += int64(utf8.RuneCountInString(u.text))
+}
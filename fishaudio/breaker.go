@@ -0,0 +1,60 @@
+package fishaudio
+
+import (
+    "errors"
+    "time"
+)
+
+var ErrCircuitOpen = errors.New("pool circuit open: recent dials failed")
+
+// breaker stops dialing a key after BreakerThreshold consecutive failures.
+// While open, dials fail fast with ErrCircuitOpen; once the open period has
+// passed a single half-open dial decides whether to close it again or to stay
+// open twice as long, up to BreakerMaxOpen.
+type breaker struct {
+    fails     int
+    openUntil time.Time
+    openFor   time.Duration
+    probing   bool
+}
+
+func (b *breaker) state(now time.Time) string {
+    switch {
+    case b.openFor == 0:
+        return "closed"
+    case b.probing || !now.Before(b.openUntil):
+        return "half-open"
+    default:
+        return "open"
+    }
+}
+
+// allowDial reports whether a dial may start; the caller holds kp.mu.
+func (p *WSConnPool) allowDial(b *breaker, now time.Time) error {
+    if p.cfg.Load().BreakerThreshold <= 0 || b.openFor == 0 { return nil }
+    if b.probing || now.Before(b.openUntil) { return ErrCircuitOpen }
+    b.probing = true
+    return nil
+}
+
+// dialed records the outcome of a dial; the caller holds kp.mu.
+func (p *WSConnPool) dialed(b *breaker, err error, now time.Time) {
+    cfg := p.cfg.Load()
+    if cfg.BreakerThreshold <= 0 { return }
+    if err == nil {
+        *b = breaker{}
+        return
+    }
+    b.fails++
+    switch {
+    case b.probing:
+        b.openFor *= 2
+        if b.openFor > cfg.BreakerMaxOpen { b.openFor = cfg.BreakerMaxOpen }
+    case b.openFor == 0 && b.fails >= cfg.BreakerThreshold:
+        b.openFor = cfg.BreakerOpen
+    default:
+        return
+    }
+    b.probing = false
+    b.openUntil = now.Add(b.openFor)
+}
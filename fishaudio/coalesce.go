@@ -0,0 +1,97 @@
+package fishaudio
+
+import (
+    "time"
+    "unicode"
+)
+
+// coalesceTexts merges strings that arrive on in within delay of each other,
+// so bursts of small LLM tokens become one text and one flush. A merged text
+// is cut at the last word or CJK character boundary once it is older than
+// delay or longer than max runes; a buffer with no boundary is sent whole
+// after twice the delay. The output is closed after in is closed and drained.
+func coalesceTexts(in <-chan string, done <-chan struct{}, delay time.Duration, max int) <-chan string {
+    if max <= 0 { max = 200 }
+    out := make(chan string)
+    go func() {
+        defer close(out)
+        var buf []rune
+        var since time.Time
+        timer := time.NewTimer(time.Hour)
+        timer.Stop()
+        defer timer.Stop()
+        // disarm stops the timer and drops a tick it has already sent, so a
+        // later Reset cannot be followed by a stale tick (go1.22 and older)
+        disarm := func() {
+            if !timer.Stop() {
+                select {
+                case <-timer.C:
+                default:
+                }
+            }
+        }
+        send := func(n int) bool {
+            t := string(buf[:n])
+            buf = append(buf[:0], buf[n:]...)
+            disarm()
+            if len(buf) > 0 {
+                since = time.Now()
+                timer.Reset(delay)
+            }
+            select {
+            case out <- t:
+                return true
+            case <-done:
+                return false
+            }
+        }
+        for {
+            select {
+            case t, ok := <-in:
+                if !ok {
+                    if len(buf) > 0 { send(len(buf)) }
+                    return
+                }
+                if t == "" { continue }
+                if len(buf) == 0 {
+                    since = time.Now()
+                    disarm()
+                    timer.Reset(delay)
+                }
+                buf = append(buf, []rune(t)...)
+                for len(buf) >= max {
+                    n := lastBoundary(buf[:max])
+                    if n == 0 { n = max }
+                    if !send(n) { return }
+                }
+            case now := <-timer.C:
+                if len(buf) == 0 { continue }
+                n := lastBoundary(buf)
+                if n == 0 {
+                    if d := 2*delay - now.Sub(since); d > 0 {
+                        timer.Reset(d)
+                        continue
+                    }
+                    n = len(buf)
+                }
+                if !send(n) { return }
+            case <-done:
+                return
+            }
+        }
+    }()
+    return out
+}
+
+// lastBoundary returns the length of the longest prefix of r that ends after
+// a space, a punctuation mark or a CJK character, or 0 if there is none.
+func lastBoundary(r []rune) int {
+    for i := len(r) - 1; i >= 0; i-- {
+        if unicode.IsSpace(r[i]) || unicode.IsPunct(r[i]) || isCJK(r[i]) { return i + 1 }
+    }
+    return 0
+}
+
+func isCJK(r rune) bool {
+    return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -0,0 +1,100 @@
+// Package fishaudiotest provides helpers for testing code built on fishaudio.
+package fishaudiotest
+
+import (
+    "sort"
+    "sync"
+    "time"
+    "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+// Clock is a fake fishaudio.Clock whose time only moves with Advance. Pass it
+// as PoolConfig.Clock to drive TTLs, deadlines and the reaper from a test.
+type Clock struct {
+    mu     sync.Mutex
+    cond   *sync.Cond
+    now    time.Time
+    timers []*timer
+}
+
+type timer struct {
+    c  *Clock
+    at time.Time
+    ch chan time.Time
+}
+
+// NewClock returns a fake clock set to now.
+func NewClock(now time.Time) *Clock {
+    c := &Clock{now: now}
+    c.cond = sync.NewCond(&c.mu)
+    return c
+}
+
+func (c *Clock) Now() time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.now
+}
+
+// NewTimer returns a timer that fires once Advance reaches now+d; a timer
+// with d <= 0 fires at once.
+func (c *Clock) NewTimer(d time.Duration) fishaudio.Timer {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    t := &timer{c: c, at: c.now.Add(d), ch: make(chan time.Time, 1)}
+    if d <= 0 {
+        t.ch <- c.now
+        return t
+    }
+    c.timers = append(c.timers, t)
+    c.cond.Broadcast()
+    return t
+}
+
+// Advance moves the clock forward by d and fires every timer that is due, in
+// deadline order. Timers created by the woken goroutines are not fired until
+// the next Advance.
+func (c *Clock) Advance(d time.Duration) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.now = c.now.Add(d)
+    sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+    n := 0
+    for n < len(c.timers) && !c.timers[n].at.After(c.now) {
+        c.timers[n].ch <- c.now
+        n++
+    }
+    c.timers = c.timers[n:]
+    c.cond.Broadcast()
+}
+
+// BlockUntil waits until n timers are pending, for example until the pool's
+// background loops are asleep again after an Advance.
+func (c *Clock) BlockUntil(n int) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for len(c.timers) < n { c.cond.Wait() }
+}
+
+// Timers reports how many timers are pending.
+func (c *Clock) Timers() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return len(c.timers)
+}
+
+func (t *timer) C() <-chan time.Time { return t.ch }
+
+func (t *timer) Stop() bool {
+    c := t.c
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for i, x := range c.timers {
+        if x == t {
+            c.timers = append(c.timers[:i], c.timers[i+1:]...)
+            c.cond.Broadcast()
+            return true
+        }
+    }
+    return false
+}
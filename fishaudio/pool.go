@@ -2,7 +2,9 @@ package fishaudio
 
 import (
     "context"
+    "errors"
     "sync"
+    "sync/atomic"
     "time"
     "net/http"
     "github.com/gorilla/websocket"
@@ -15,104 +17,372 @@ type ClientOptions struct {
     MaxLife        time.Duration
     WSReadTimeout  time.Duration
     WSPingInterval time.Duration
+    WSWriteTimeout time.Duration
     AudioBuf       int
     PacketsBuf     int
     TextIdleTTL    time.Duration
+    UtteranceGap   time.Duration
+    ReconnectAttempts int
+    DropReplayedAudio bool
+    StallTimeout   time.Duration
+    StallRedial    bool
+    CoalesceDelay  time.Duration
+    CoalesceMaxChars int
+    SendQueueLimit int
+    SendOverflow   OverflowPolicy
 }
 
 type WSConnPool struct {
     mu              sync.Mutex
     m               map[string]*keyPool
     wsIndex         map[*websocket.Conn]*poolEntry
-    maxPerKey       int
-    idleTTL         time.Duration
-    maxLife         time.Duration
-    textIdleTTL     time.Duration
+    cfg             atomic.Pointer[PoolConfig]
+    total           int
+    gwaiters        []chan struct{}
+    clock           Clock
+    probeRunning    bool
+    hookMu          sync.Mutex
+    evictions       []evictNote
 }
 
+// PoolConfig configures a WSConnPool. Zero fields take their defaults.
+type PoolConfig struct {
+    // MaxPerKey caps the sockets of one key (default 4).
+    MaxPerKey int
+    // MaxTotalConns > 0 caps the sockets of all keys together; at the cap the
+    // least recently used idle socket of any key is closed, or the caller
+    // waits its turn.
+    MaxTotalConns int
+    // IdleTTL closes sockets idle for longer (default 60s).
+    IdleTTL time.Duration
+    // MaxLife closes sockets older than this (default 10m).
+    MaxLife time.Duration
+    // TextIdleTTL closes idle sockets that have carried no text for longer
+    // (default 2m).
+    TextIdleTTL time.Duration
+    // ProbeOnAcquire pings an idle socket before handing it out; a dead one
+    // is dropped and the caller gets a new dial.
+    ProbeOnAcquire bool
+    // ProbeInterval > 0 checks idle sockets in the background that often.
+    ProbeInterval time.Duration
+    // ProbeTimeout is how long a probe waits for the pong (default 1s).
+    ProbeTimeout time.Duration
+    // BreakerThreshold > 0 stops dialing a key after that many consecutive
+    // dial failures.
+    BreakerThreshold int
+    // BreakerOpen is how long the breaker stays open at first (default 1s).
+    BreakerOpen time.Duration
+    // BreakerMaxOpen caps the open period, which doubles while half-open
+    // dials keep failing (default 30s, or BreakerOpen if longer).
+    BreakerMaxOpen time.Duration
+    // Policies override MaxPerKey and the TTLs for matching keys.
+    Policies []KeyPolicy
+    // Hooks observe dials, leases and evictions.
+    Hooks PoolHooks
+    // ReapInterval is how often expired idle sockets are closed (default 5s).
+    ReapInterval time.Duration
+    // Clock replaces the system clock, mainly in tests. It is fixed when the
+    // pool is created; Update keeps the original.
+    Clock Clock
+}
+
+var ErrAcquireTimeout = errors.New("pool acquire deadline exceeded")
+
 type keyPool struct {
     mu      sync.Mutex
+    key     string
+    clock   Clock
     entries []*poolEntry
-    waiters []chan *poolEntry
+    dialing int
+    waiters []*poolWaiter
+    seq     uint64
+    stats   keyCounters
+    breaker breaker
+    limits  keyLimits
+    minIdle int
+    redial  func() (*websocket.Conn, *http.Response, error)
+    warming bool
+}
+
+// poolWaiter is an Acquire blocked on a full key. Waiters are served by
+// descending priority and in arrival order within a priority.
+type poolWaiter struct {
+    ch   chan *poolEntry
+    prio int
+    seq  uint64
 }
 
+// AcquireOption sets how one Acquire waits for a busy key.
+type AcquireOption func(*acquireConfig)
+
+type acquireConfig struct {
+    prio     int
+    deadline time.Time
+}
+
+// AcquirePriority serves the caller before waiters with a lower priority.
+func AcquirePriority(n int) AcquireOption { return func(ac *acquireConfig) { ac.prio = n } }
+
+// AcquireDeadline gives up waiting at t with ErrAcquireTimeout.
+func AcquireDeadline(t time.Time) AcquireOption { return func(ac *acquireConfig) { ac.deadline = t } }
+
 type poolEntry struct {
+    key      string
     ws       *websocket.Conn
     busy     bool
+    probing  bool
+    surplus  bool
     created  time.Time
     lastUsed time.Time
     lastText time.Time
 }
 
 func NewWSConnPool(maxPerKey int, idleTTL time.Duration, maxLife time.Duration, textIdleTTL time.Duration) *WSConnPool {
-    if maxPerKey <= 0 { maxPerKey = 4 }
-    if idleTTL <= 0 { idleTTL = 60 * time.Second }
-    if maxLife <= 0 { maxLife = 10 * time.Minute }
-    if textIdleTTL <= 0 { textIdleTTL = 2 * time.Minute }
-    p := &WSConnPool{m: make(map[string]*keyPool), wsIndex: make(map[*websocket.Conn]*poolEntry), maxPerKey: maxPerKey, idleTTL: idleTTL, maxLife: maxLife, textIdleTTL: textIdleTTL}
+    return NewWSConnPoolConfig(PoolConfig{MaxPerKey: maxPerKey, IdleTTL: idleTTL, MaxLife: maxLife, TextIdleTTL: textIdleTTL})
+}
+
+func NewWSConnPoolConfig(cfg PoolConfig) *WSConnPool {
+    cfg.normalize()
+    p := &WSConnPool{m: make(map[string]*keyPool), wsIndex: make(map[*websocket.Conn]*poolEntry), clock: cfg.Clock}
+    p.cfg.Store(&cfg)
     go p.reapLoop()
+    p.mu.Lock()
+    p.startProbeLocked()
+    p.mu.Unlock()
     return p
 }
 
+func (cfg *PoolConfig) normalize() {
+    if cfg.MaxPerKey <= 0 { cfg.MaxPerKey = 4 }
+    if cfg.IdleTTL <= 0 { cfg.IdleTTL = 60 * time.Second }
+    if cfg.MaxLife <= 0 { cfg.MaxLife = 10 * time.Minute }
+    if cfg.TextIdleTTL <= 0 { cfg.TextIdleTTL = 2 * time.Minute }
+    if cfg.ProbeTimeout <= 0 { cfg.ProbeTimeout = time.Second }
+    if cfg.BreakerOpen <= 0 { cfg.BreakerOpen = time.Second }
+    if cfg.BreakerMaxOpen < cfg.BreakerOpen {
+        cfg.BreakerMaxOpen = 30 * time.Second
+        if cfg.BreakerOpen > cfg.BreakerMaxOpen { cfg.BreakerMaxOpen = cfg.BreakerOpen }
+    }
+    if cfg.ReapInterval <= 0 { cfg.ReapInterval = 5 * time.Second }
+    if cfg.Clock == nil { cfg.Clock = realClock{} }
+}
+
+// Config returns the settings the pool currently runs with.
+func (p *WSConnPool) Config() PoolConfig { return *p.cfg.Load() }
+
 func (p *WSConnPool) get(key string) *keyPool {
     p.mu.Lock()
     kp := p.m[key]
-    if kp == nil { kp = &keyPool{}; p.m[key] = kp }
+    if kp == nil {
+        kp = &keyPool{key: key, clock: p.clock, limits: p.cfg.Load().limitsFor(key)}
+        p.m[key] = kp
+    }
     p.mu.Unlock()
     return kp
 }
 
-func (p *WSConnPool) Acquire(ctx context.Context, key string, dial func() (*websocket.Conn, *http.Response, error)) (*websocket.Conn, func(), func(), error) {
+func (p *WSConnPool) Acquire(ctx context.Context, key string, dial func() (*websocket.Conn, *http.Response, error), opts ...AcquireOption) (*websocket.Conn, func(), func(), error) {
+    e, _, err := p.acquire(ctx, key, dial, opts...)
+    if err != nil { return nil, nil, nil, err }
+    release := func() { p.release(e) }
+    force := func() { p.forceClose(e) }
+    return e.ws, release, force, nil
+}
+
+// acquireInfo describes how a lease was obtained: Dial is zero when an idle
+// connection was reused.
+type acquireInfo struct {
+    Reused bool
+    Dial   time.Duration
+}
+
+func (p *WSConnPool) acquire(ctx context.Context, key string, dial func() (*websocket.Conn, *http.Response, error), opts ...AcquireOption) (*poolEntry, acquireInfo, error) {
+    var ac acquireConfig
+    for _, o := range opts { o(&ac) }
+    var expire <-chan time.Time
+    if !ac.deadline.IsZero() {
+        t := p.clock.NewTimer(ac.deadline.Sub(p.now()))
+        defer t.Stop()
+        expire = t.C()
+    }
+    defer p.flushHooks()
     kp := p.get(key)
+    var w *poolWaiter
+    start := p.now()
+    slot := false // a pool-wide slot handed over while waiting
+    defer func() { if slot { p.freeSlots(1) } }()
     for {
-        entry, release, forceClose := p.tryAcquire(kp, key)
-        if entry != nil { return entry.ws, release, forceClose, nil }
+        if entry := p.tryAcquire(kp); entry != nil {
+            if cfg := p.cfg.Load(); cfg.ProbeOnAcquire {
+                if err := probe(ctx, entry.ws, cfg.ProbeTimeout); err == errProbeFailed {
+                    p.evict(entry, EvictDead)
+                    continue
+                } else if err != nil {
+                    p.putBack(entry)
+                    return nil, acquireInfo{}, err
+                }
+            }
+            wait := p.since(start)
+            kp.mu.Lock()
+            kp.stats.reused(wait)
+            kp.mu.Unlock()
+            p.acquireHook(key, wait, true)
+            return entry, acquireInfo{Reused: true}, nil
+        }
         kp.mu.Lock()
-        if len(kp.entries) < p.maxPerKey {
+        if len(kp.entries)+kp.dialing < kp.limits.maxPerKey {
+            if err := p.allowDial(&kp.breaker, p.now()); err != nil {
+                kp.mu.Unlock()
+                return nil, acquireInfo{}, err
+            }
+            kp.dialing++
             kp.mu.Unlock()
+            if !slot && !p.reserve(true) {
+                kp.mu.Lock()
+                kp.dialing--
+                kp.breaker.probing = false
+                kp.handoff(nil)
+                kp.mu.Unlock()
+                if err := p.waitSlot(ctx, expire); err != nil { return nil, acquireInfo{}, err }
+                slot = true
+                continue
+            }
+            slot = false
+            kp.mu.Lock()
+            kp.stats.waited(p.since(start))
+            kp.mu.Unlock()
+            t0 := p.now()
             ws, _, err := dial()
-            if err != nil { return nil, nil, nil, err }
-            e := &poolEntry{ws: ws, busy: true, created: time.Now(), lastUsed: time.Now()}
             kp.mu.Lock()
+            kp.dialing--
+            kp.stats.dials++
+            p.dialed(&kp.breaker, err, p.now())
+            if err != nil {
+                kp.stats.dialFailures++
+                kp.handoff(nil)
+                kp.mu.Unlock()
+                p.freeSlots(1)
+                p.dialHook(key, p.since(t0), err)
+                return nil, acquireInfo{}, err
+            }
+            info := acquireInfo{Dial: p.since(t0)}
+            e := &poolEntry{key: key, ws: ws, busy: true, created: p.now(), lastUsed: p.now()}
             kp.entries = append(kp.entries, e)
             kp.mu.Unlock()
             p.mu.Lock()
             p.wsIndex[ws] = e
             p.mu.Unlock()
-            release := func() { p.release(key, e) }
-            force := func() { p.forceClose(key, e) }
-            return ws, release, force, nil
+            p.dialHook(key, info.Dial, nil)
+            p.acquireHook(key, p.since(start), false)
+            return e, info, nil
+        }
+        if slot {
+            kp.mu.Unlock()
+            p.freeSlots(1)
+            slot = false
+            kp.mu.Lock()
+        }
+        // a waiter woken to dial keeps its place if it has to wait again
+        if w == nil {
+            kp.seq++
+            w = &poolWaiter{prio: ac.prio, seq: kp.seq}
         }
-        ch := make(chan *poolEntry, 1)
-        kp.waiters = append(kp.waiters, ch)
+        w.ch = make(chan *poolEntry, 1)
+        kp.enqueue(w)
         kp.mu.Unlock()
         select {
-        case e := <-ch:
+        case e := <-w.ch:
             if e == nil { continue }
-            release := func() { p.release(key, e) }
-            force := func() { p.forceClose(key, e) }
-            return e.ws, release, force, nil
+            wait := p.since(start)
+            kp.mu.Lock()
+            kp.stats.reused(wait)
+            kp.mu.Unlock()
+            p.acquireHook(key, wait, true)
+            return e, acquireInfo{Reused: true}, nil
         case <-ctx.Done():
-            return nil, nil, nil, ctx.Err()
+            return nil, acquireInfo{}, p.abandonWait(kp, w, ctx.Err())
+        case <-expire:
+            return nil, acquireInfo{}, p.abandonWait(kp, w, ErrAcquireTimeout)
+        }
+    }
+}
+
+// abandonWait takes a cancelled waiter out of the queue. If a connection or a
+// wakeup was already handed to it, that is passed on to the next waiter.
+func (p *WSConnPool) abandonWait(kp *keyPool, w *poolWaiter, err error) error {
+    kp.mu.Lock()
+    if kp.remove(w) {
+        kp.mu.Unlock()
+        return err
+    }
+    kp.mu.Unlock()
+    if e := <-w.ch; e != nil {
+        p.putBack(e)
+    } else {
+        kp.mu.Lock()
+        kp.handoff(nil)
+        kp.mu.Unlock()
+    }
+    return err
+}
+
+// enqueue inserts w after every waiter it must not overtake; the caller holds kp.mu.
+func (kp *keyPool) enqueue(w *poolWaiter) {
+    i := 0
+    for i < len(kp.waiters) && (kp.waiters[i].prio > w.prio || kp.waiters[i].prio == w.prio && kp.waiters[i].seq < w.seq) { i++ }
+    kp.waiters = append(kp.waiters, nil)
+    copy(kp.waiters[i+1:], kp.waiters[i:])
+    kp.waiters[i] = w
+}
+
+// remove drops w from the queue and reports whether it was still waiting.
+func (kp *keyPool) remove(w *poolWaiter) bool {
+    for i, x := range kp.waiters {
+        if x == w {
+            kp.waiters = append(kp.waiters[:i], kp.waiters[i+1:]...)
+            return true
         }
     }
+    return false
+}
+
+func (kp *keyPool) has(e *poolEntry) bool {
+    for _, x := range kp.entries { if x == e { return true } }
+    return false
+}
+
+// handoff gives e to the first waiter, or with a nil e wakes it to dial into a
+// freed slot. The caller holds kp.mu.
+func (kp *keyPool) handoff(e *poolEntry) bool {
+    if len(kp.waiters) == 0 { return false }
+    w := kp.waiters[0]
+    kp.waiters = kp.waiters[1:]
+    if e != nil {
+        e.busy = true
+        e.lastUsed = kp.clock.Now()
+    }
+    w.ch <- e
+    return true
 }
 
-func (p *WSConnPool) tryAcquire(kp *keyPool, key string) (*poolEntry, func(), func()) {
-    now := time.Now()
+func (p *WSConnPool) tryAcquire(kp *keyPool) *poolEntry {
+    now := p.now()
     kp.mu.Lock()
     var chosen *poolEntry
+    var evicted []*poolEntry
     var i int
     for i = 0; i < len(kp.entries); i++ {
         e := kp.entries[i]
-        if p.expired(e, now) {
+        if reason := kp.expiry(e, now); reason != "" {
             _ = e.ws.Close()
+            p.evicted(kp, reason)
+            evicted = append(evicted, e)
             kp.entries[i] = kp.entries[len(kp.entries)-1]
             kp.entries = kp.entries[:len(kp.entries)-1]
             i--
             continue
         }
-        if !e.busy {
+        if !e.busy && !e.probing {
             e.busy = true
             e.lastUsed = now
             chosen = e
@@ -120,86 +390,258 @@ func (p *WSConnPool) tryAcquire(kp *keyPool, key string) (*poolEntry, func(), fu
         }
     }
     kp.mu.Unlock()
-    if chosen == nil { return nil, nil, nil }
-    release := func() { p.release(key, chosen) }
-    force := func() { p.forceClose(key, chosen) }
-    return chosen, release, force
+    p.unindex(evicted)
+    return chosen
 }
 
-func (p *WSConnPool) expired(e *poolEntry, now time.Time) bool {
-    if p.maxLife > 0 && now.Sub(e.created) > p.maxLife { return true }
-    if p.idleTTL > 0 && !e.busy && now.Sub(e.lastUsed) > p.idleTTL { return true }
-    if p.textIdleTTL > 0 && !e.busy {
-        if !e.lastText.IsZero() && now.Sub(e.lastText) > p.textIdleTTL { return true }
-        if e.lastText.IsZero() && now.Sub(e.lastUsed) > p.textIdleTTL { return true }
+// unindex forgets evicted entries and frees their slots.
+func (p *WSConnPool) unindex(es []*poolEntry) {
+    if len(es) == 0 { return }
+    p.mu.Lock()
+    for _, e := range es {
+        delete(p.wsIndex, e.ws)
+        p.freeSlotLocked()
+    }
+    p.mu.Unlock()
+}
+
+// Warm dials until key has n idle connections or is full, so the first
+// sessions skip the handshake. A waiter blocked on the key takes a new
+// connection right away.
+func (p *WSConnPool) Warm(ctx context.Context, key string, n int, dial func() (*websocket.Conn, *http.Response, error)) error {
+    defer p.flushHooks()
+    kp := p.get(key)
+    for {
+        if err := ctx.Err(); err != nil { return err }
+        kp.mu.Lock()
+        idle := 0
+        for _, e := range kp.entries { if !e.busy { idle++ } }
+        if idle >= n || len(kp.entries)+kp.dialing >= kp.limits.maxPerKey {
+            kp.mu.Unlock()
+            return nil
+        }
+        if err := p.allowDial(&kp.breaker, p.now()); err != nil {
+            kp.mu.Unlock()
+            return err
+        }
+        kp.dialing++
+        kp.mu.Unlock()
+        if !p.reserve(false) {
+            kp.mu.Lock()
+            kp.dialing--
+            kp.breaker.probing = false
+            kp.handoff(nil)
+            kp.mu.Unlock()
+            return nil
+        }
+        t0 := p.now()
+        ws, _, err := dial()
+        d := p.since(t0)
+        kp.mu.Lock()
+        kp.dialing--
+        kp.stats.dials++
+        p.dialed(&kp.breaker, err, p.now())
+        if err != nil {
+            kp.stats.dialFailures++
+            kp.handoff(nil)
+            kp.mu.Unlock()
+            p.freeSlots(1)
+            p.dialHook(key, d, err)
+            return err
+        }
+        now := p.now()
+        e := &poolEntry{key: key, ws: ws, created: now, lastUsed: now}
+        kp.entries = append(kp.entries, e)
+        kp.handoff(e)
+        kp.mu.Unlock()
+        p.mu.Lock()
+        p.wsIndex[ws] = e
+        p.mu.Unlock()
+        p.dialHook(key, d, nil)
     }
-    return false
 }
 
-func (p *WSConnPool) release(key string, e *poolEntry) {
+// SetMinIdle keeps at least n idle connections for key, dialing with dial
+// now and whenever the reaper finds fewer. n = 0 stops maintaining the key.
+func (p *WSConnPool) SetMinIdle(key string, n int, dial func() (*websocket.Conn, *http.Response, error)) {
     kp := p.get(key)
     kp.mu.Lock()
-    e.busy = false
-    e.lastUsed = time.Now()
-    if len(kp.waiters) > 0 {
-        ch := kp.waiters[0]
-        kp.waiters = kp.waiters[1:]
-        e.busy = true
-        ch <- e
-        close(ch)
+    kp.minIdle, kp.redial = n, dial
+    kp.mu.Unlock()
+    p.refill(key, kp)
+}
+
+// refill warms key in the background up to its MinIdle, one run at a time.
+func (p *WSConnPool) refill(key string, kp *keyPool) {
+    kp.mu.Lock()
+    n, dial := kp.minIdle, kp.redial
+    if n <= 0 || dial == nil || kp.warming {
+        kp.mu.Unlock()
+        return
     }
+    kp.warming = true
     kp.mu.Unlock()
+    go func() {
+        _ = p.Warm(context.Background(), key, n, dial)
+        kp.mu.Lock()
+        kp.warming = false
+        kp.mu.Unlock()
+    }()
 }
 
-func (p *WSConnPool) forceClose(key string, e *poolEntry) {
-    _ = e.ws.Close()
-    kp := p.get(key)
+// IdleCount reports how many warm connections are ready to be leased for key.
+func (p *WSConnPool) IdleCount(key string) int {
+    p.mu.Lock()
+    kp := p.m[key]
+    p.mu.Unlock()
+    if kp == nil { return 0 }
+    now := p.now()
+    n := 0
     kp.mu.Lock()
-    for i := 0; i < len(kp.entries); i++ {
-        if kp.entries[i] == e {
-            kp.entries[i] = kp.entries[len(kp.entries)-1]
-            kp.entries = kp.entries[:len(kp.entries)-1]
-            break
-        }
+    for _, e := range kp.entries { if !e.busy && kp.expiry(e, now) == "" { n++ } }
+    kp.mu.Unlock()
+    return n
+}
+
+// expiry returns why e has to be evicted at now, or "" if it may stay; the
+// caller holds kp.mu.
+func (kp *keyPool) expiry(e *poolEntry, now time.Time) EvictReason {
+    l := kp.limits
+    if l.maxLife > 0 && now.Sub(e.created) > l.maxLife { return EvictMaxLife }
+    if l.idleTTL > 0 && !e.busy && now.Sub(e.lastUsed) > l.idleTTL { return EvictIdleTTL }
+    if l.textIdleTTL > 0 && !e.busy {
+        if !e.lastText.IsZero() && now.Sub(e.lastText) > l.textIdleTTL { return EvictTextIdleTTL }
+        if e.lastText.IsZero() && now.Sub(e.lastUsed) > l.textIdleTTL { return EvictTextIdleTTL }
     }
-    if len(kp.waiters) > 0 {
-        ch := kp.waiters[0]
-        kp.waiters = kp.waiters[1:]
-        ch <- nil
-        close(ch)
+    return ""
+}
+
+func (p *WSConnPool) entryKey(e *poolEntry) string {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    return e.key
+}
+
+func (p *WSConnPool) release(e *poolEntry) {
+    key, held := p.putBack(e)
+    p.releaseHook(key, held, false)
+}
+
+// putBack returns a lease to the pool and reports how long it was held.
+func (p *WSConnPool) putBack(e *poolEntry) (string, time.Duration) {
+    kp := p.get(p.entryKey(e))
+    kp.mu.Lock()
+    now := p.now()
+    held := now.Sub(e.lastUsed)
+    e.busy = false
+    e.lastUsed = now
+    // an entry reaped while leased is gone; its slot is free instead
+    present := kp.has(e)
+    surplus := e.surplus
+    e.surplus = false
+    if present && len(kp.entries) > kp.limits.maxPerKey {
+        // the key was shrunk by Update, or e was moved onto a full key
+        kp.remove1(e)
+        if surplus { p.evicted(kp, EvictRekey) } else { p.evicted(kp, EvictResize) }
+        kp.mu.Unlock()
+        _ = e.ws.Close()
+        p.unindex([]*poolEntry{e})
+        return kp.key, held
     }
+    handed := false
+    if present { handed = kp.handoff(e) } else { kp.handoff(nil) }
+    kp.mu.Unlock()
+    if present && !handed { p.makeRoom(kp, e) }
+    return kp.key, held
+}
+
+func (p *WSConnPool) forceClose(e *poolEntry) {
+    kp := p.get(p.entryKey(e))
+    kp.mu.Lock()
+    held := p.since(e.lastUsed)
+    kp.mu.Unlock()
+    p.evict(e, EvictForced)
+    p.releaseHook(kp.key, held, true)
+}
+
+func (p *WSConnPool) evict(e *poolEntry, reason EvictReason) {
+    defer p.flushHooks()
+    _ = e.ws.Close()
+    kp := p.get(p.entryKey(e))
+    kp.mu.Lock()
+    removed := kp.remove1(e)
+    if removed { p.evicted(kp, reason) }
+    kp.handoff(nil)
     kp.mu.Unlock()
     p.mu.Lock()
     delete(p.wsIndex, e.ws)
+    if removed { p.freeSlotLocked() }
     p.mu.Unlock()
 }
 
 func (p *WSConnPool) TouchText(ws *websocket.Conn) {
     p.mu.Lock()
-    if e, ok := p.wsIndex[ws]; ok { e.lastText = time.Now() }
+    if e, ok := p.wsIndex[ws]; ok { e.lastText = p.now() }
     p.mu.Unlock()
 }
 
+// Rekey moves a leased connection to another key, for a session that restarted
+// with a different format or reference id. The lease is returned under the new
+// key on release, or closed then if that key is over its MaxPerKey.
+func (p *WSConnPool) Rekey(ws *websocket.Conn, key string) {
+    p.mu.Lock()
+    e, ok := p.wsIndex[ws]
+    if !ok || e.key == key {
+        p.mu.Unlock()
+        return
+    }
+    old := e.key
+    e.key = key
+    p.mu.Unlock()
+    kp := p.get(old)
+    kp.mu.Lock()
+    for i := 0; i < len(kp.entries); i++ {
+        if kp.entries[i] == e {
+            kp.entries[i] = kp.entries[len(kp.entries)-1]
+            kp.entries = kp.entries[:len(kp.entries)-1]
+            break
+        }
+    }
+    kp.handoff(nil)
+    kp.mu.Unlock()
+    nkp := p.get(key)
+    nkp.mu.Lock()
+    nkp.entries = append(nkp.entries, e)
+    e.surplus = len(nkp.entries) > nkp.limits.maxPerKey
+    nkp.mu.Unlock()
+}
+
 func (p *WSConnPool) reapLoop() {
-    t := time.NewTicker(5 * time.Second)
-    defer t.Stop()
-    for range t.C {
-        now := time.Now()
+    for {
+        p.sleep(p.cfg.Load().ReapInterval)
+        now := p.now()
         p.mu.Lock()
         for _, kp := range p.m {
             kp.mu.Lock()
             for i := 0; i < len(kp.entries); i++ {
                 e := kp.entries[i]
-                if p.expired(e, now) {
+                if reason := kp.expiry(e, now); reason != "" {
                     _ = e.ws.Close()
+                    p.evicted(kp, reason)
                     delete(p.wsIndex, e.ws)
                     kp.entries[i] = kp.entries[len(kp.entries)-1]
                     kp.entries = kp.entries[:len(kp.entries)-1]
                     i--
+                    kp.handoff(nil)
+                    p.freeSlotLocked()
                 }
             }
             kp.mu.Unlock()
         }
+        keys := make(map[string]*keyPool, len(p.m))
+        for k, kp := range p.m { keys[k] = kp }
         p.mu.Unlock()
+        p.flushHooks()
+        for k, kp := range keys { p.refill(k, kp) }
     }
 }
\ No newline at end of file
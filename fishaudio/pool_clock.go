@@ -0,0 +1,36 @@
+package fishaudio
+
+import "time"
+
+// Clock is the time source of a WSConnPool. TTLs, the reaper, acquire
+// deadlines and the breaker all read it, so a fake clock such as
+// fishaudiotest.Clock drives them in tests without sleeping.
+type Clock interface {
+    Now() time.Time
+    NewTimer(d time.Duration) Timer
+}
+
+// Timer is a one-shot timer created by a Clock.
+type Timer interface {
+    C() <-chan time.Time
+    Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+
+func (t realTimer) Stop() bool { return t.t.Stop() }
+
+func (p *WSConnPool) now() time.Time { return p.clock.Now() }
+
+func (p *WSConnPool) since(t time.Time) time.Duration { return p.clock.Now().Sub(t) }
+
+// sleep waits d on the pool's clock.
+func (p *WSConnPool) sleep(d time.Duration) { <-p.clock.NewTimer(d).C() }
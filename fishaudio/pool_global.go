@@ -0,0 +1,126 @@
+package fishaudio
+
+import (
+    "context"
+    "time"
+)
+
+// reserve takes one of the pool-wide MaxTotalConns slots for a dial. When
+// none is free and nobody is queued for one, the least recently used idle
+// connection of any key is evicted to make room.
+func (p *WSConnPool) reserve(evict bool) bool {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if max := p.cfg.Load().MaxTotalConns; max <= 0 || p.total < max {
+        p.total++
+        return true
+    }
+    return evict && len(p.gwaiters) == 0 && p.evictLRULocked(EvictLRU)
+}
+
+// freeSlots gives back n slots. A caller queued for a slot takes it over
+// directly, so slots are handed out in arrival order across keys, unless the
+// pool is above a cap lowered by Update.
+func (p *WSConnPool) freeSlots(n int) {
+    p.mu.Lock()
+    for ; n > 0; n-- { p.freeSlotLocked() }
+    p.mu.Unlock()
+}
+
+func (p *WSConnPool) freeSlotLocked() {
+    max := p.cfg.Load().MaxTotalConns
+    if len(p.gwaiters) > 0 && (max <= 0 || p.total <= max) {
+        ch := p.gwaiters[0]
+        p.gwaiters = p.gwaiters[1:]
+        ch <- struct{}{}
+        return
+    }
+    p.total--
+}
+
+// waitSlot queues for a pool-wide slot. On success the caller owns the slot.
+func (p *WSConnPool) waitSlot(ctx context.Context, expire <-chan time.Time) error {
+    ch := make(chan struct{}, 1)
+    p.mu.Lock()
+    p.gwaiters = append(p.gwaiters, ch)
+    p.mu.Unlock()
+    var err error
+    select {
+    case <-ch:
+        return nil
+    case <-ctx.Done():
+        err = ctx.Err()
+    case <-expire:
+        err = ErrAcquireTimeout
+    }
+    p.mu.Lock()
+    for i, x := range p.gwaiters {
+        if x == ch {
+            p.gwaiters = append(p.gwaiters[:i], p.gwaiters[i+1:]...)
+            p.mu.Unlock()
+            return err
+        }
+    }
+    p.mu.Unlock()
+    // the slot arrived as we gave up; pass it on
+    <-ch
+    p.freeSlots(1)
+    return err
+}
+
+// evictLRULocked closes the idle connection that was used least recently,
+// keeping its slot for the caller. The caller holds p.mu.
+func (p *WSConnPool) evictLRULocked(reason EvictReason) bool {
+    for {
+        var best *poolEntry
+        var bestKP *keyPool
+        for _, kp := range p.m {
+            kp.mu.Lock()
+            for _, e := range kp.entries {
+                if !e.busy && !e.probing && (best == nil || e.lastUsed.Before(best.lastUsed)) { best, bestKP = e, kp }
+            }
+            kp.mu.Unlock()
+        }
+        if best == nil { return false }
+        bestKP.mu.Lock()
+        if best.busy || best.probing || !bestKP.remove1(best) {
+            // taken meanwhile; look again
+            bestKP.mu.Unlock()
+            continue
+        }
+        p.evicted(bestKP, reason)
+        bestKP.mu.Unlock()
+        _ = best.ws.Close()
+        delete(p.wsIndex, best.ws)
+        return true
+    }
+}
+
+// remove1 drops e from the key's entries; the caller holds kp.mu.
+func (kp *keyPool) remove1(e *poolEntry) bool {
+    for i := 0; i < len(kp.entries); i++ {
+        if kp.entries[i] == e {
+            kp.entries[i] = kp.entries[len(kp.entries)-1]
+            kp.entries = kp.entries[:len(kp.entries)-1]
+            return true
+        }
+    }
+    return false
+}
+
+// makeRoom evicts an idle connection that was just released when callers of
+// other keys are queued for a pool-wide slot or the pool is above its cap.
+func (p *WSConnPool) makeRoom(kp *keyPool, e *poolEntry) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    max := p.cfg.Load().MaxTotalConns
+    if len(p.gwaiters) == 0 && (max <= 0 || p.total <= max) { return }
+    kp.mu.Lock()
+    ok := !e.busy && !e.probing && kp.remove1(e)
+    if ok { p.evicted(kp, EvictLRU) }
+    kp.mu.Unlock()
+    if !ok { return }
+    _ = e.ws.Close()
+    delete(p.wsIndex, e.ws)
+    p.freeSlotLocked()
+}
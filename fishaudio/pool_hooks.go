@@ -0,0 +1,64 @@
+package fishaudio
+
+import "time"
+
+// PoolHooks are called on connection lifecycle events, for metrics and audit
+// logs. Hooks run on the caller's goroutine after the pool has released its
+// locks, so they may call back into the pool, but a slow hook delays the
+// Acquire or release that triggered it. Nil hooks are skipped.
+//
+// OnDial reports every dial with its duration and error. OnAcquire reports a
+// lease with the time the caller waited, including any dial, and whether an
+// idle connection was reused. OnRelease reports a lease handed back after
+// held; forced is set when the lease was closed instead, which is also
+// reported to OnEvict as EvictForced. OnEvict reports every connection the
+// pool closes, including those dropped by the reaper or found expired on
+// acquire.
+type PoolHooks struct {
+    OnDial    func(key string, d time.Duration, err error)
+    OnAcquire func(key string, wait time.Duration, reused bool)
+    OnRelease func(key string, held time.Duration, forced bool)
+    OnEvict   func(key string, reason EvictReason)
+}
+
+type evictNote struct {
+    key    string
+    reason EvictReason
+}
+
+// evicted counts an eviction on kp and queues it for OnEvict; the caller
+// holds kp.mu and possibly p.mu.
+func (p *WSConnPool) evicted(kp *keyPool, reason EvictReason) {
+    kp.stats.evicted(reason)
+    if p.cfg.Load().Hooks.OnEvict == nil { return }
+    p.hookMu.Lock()
+    p.evictions = append(p.evictions, evictNote{kp.key, reason})
+    p.hookMu.Unlock()
+}
+
+// flushHooks delivers queued evictions. It is called with no lock held.
+func (p *WSConnPool) flushHooks() {
+    p.hookMu.Lock()
+    ns := p.evictions
+    p.evictions = nil
+    p.hookMu.Unlock()
+    if len(ns) == 0 { return }
+    h := p.cfg.Load().Hooks.OnEvict
+    if h == nil { return }
+    for _, n := range ns { h(n.key, n.reason) }
+}
+
+func (p *WSConnPool) dialHook(key string, d time.Duration, err error) {
+    p.flushHooks()
+    if h := p.cfg.Load().Hooks.OnDial; h != nil { h(key, d, err) }
+}
+
+func (p *WSConnPool) acquireHook(key string, wait time.Duration, reused bool) {
+    p.flushHooks()
+    if h := p.cfg.Load().Hooks.OnAcquire; h != nil { h(key, wait, reused) }
+}
+
+func (p *WSConnPool) releaseHook(key string, held time.Duration, forced bool) {
+    p.flushHooks()
+    if h := p.cfg.Load().Hooks.OnRelease; h != nil { h(key, held, forced) }
+}
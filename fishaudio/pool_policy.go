@@ -0,0 +1,55 @@
+package fishaudio
+
+import (
+    "strings"
+    "time"
+)
+
+// KeyPolicy overrides the pool limits for the keys it matches. Backend,
+// Format and ReferenceID match the parts of a BaseURL|backend|format|reference_id
+// key, ignoring a WithPoolKeySuffix suffix after it; an empty matcher matches
+// anything. Zero limits keep the pool default.
+type KeyPolicy struct {
+    Backend     string
+    Format      string
+    ReferenceID string
+    MaxPerKey   int
+    IdleTTL     time.Duration
+    MaxLife     time.Duration
+    TextIdleTTL time.Duration
+}
+
+// keyLimits are the limits in force for one key.
+type keyLimits struct {
+    maxPerKey   int
+    idleTTL     time.Duration
+    maxLife     time.Duration
+    textIdleTTL time.Duration
+}
+
+func (kp KeyPolicy) matches(key string) bool {
+    // parts[4], if any, is a key suffix
+    parts := strings.SplitN(key, "|", 5)
+    part := func(i int) string {
+        if i < len(parts) { return parts[i] }
+        return ""
+    }
+    if kp.Backend != "" && !strings.EqualFold(kp.Backend, part(1)) { return false }
+    if kp.Format != "" && !strings.EqualFold(kp.Format, part(2)) { return false }
+    if kp.ReferenceID != "" && kp.ReferenceID != part(3) { return false }
+    return true
+}
+
+// limitsFor returns the limits of key under the first matching policy.
+func (cfg *PoolConfig) limitsFor(key string) keyLimits {
+    l := keyLimits{maxPerKey: cfg.MaxPerKey, idleTTL: cfg.IdleTTL, maxLife: cfg.MaxLife, textIdleTTL: cfg.TextIdleTTL}
+    for _, kp := range cfg.Policies {
+        if !kp.matches(key) { continue }
+        if kp.MaxPerKey > 0 { l.maxPerKey = kp.MaxPerKey }
+        if kp.IdleTTL > 0 { l.idleTTL = kp.IdleTTL }
+        if kp.MaxLife > 0 { l.maxLife = kp.MaxLife }
+        if kp.TextIdleTTL > 0 { l.textIdleTTL = kp.TextIdleTTL }
+        break
+    }
+    return l
+}
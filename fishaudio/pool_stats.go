@@ -0,0 +1,106 @@
+package fishaudio
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+)
+
+// EvictReason says why the pool closed a connection.
+type EvictReason string
+
+const (
+    EvictMaxLife     EvictReason = "maxLife"
+    EvictIdleTTL     EvictReason = "idleTTL"
+    EvictTextIdleTTL EvictReason = "textIdleTTL"
+    EvictForced      EvictReason = "forced"
+    EvictDead        EvictReason = "dead"
+    EvictLRU         EvictReason = "lru"
+    EvictResize      EvictReason = "resize"
+    EvictRekey       EvictReason = "rekey"
+)
+
+// WaitBounds are the upper bounds of the acquire wait histogram buckets; the
+// last bucket of WaitHistogram.Counts holds the waits above the last bound.
+var WaitBounds = []time.Duration{time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second}
+
+// WaitHistogram counts how long Acquire calls waited before they got an idle
+// connection or a free slot to dial into.
+type WaitHistogram struct {
+    Bounds []time.Duration `json:"bounds"`
+    Counts []int64         `json:"counts"`
+    Sum    time.Duration   `json:"sum"`
+}
+
+// PoolKeyStats are the counters of one pool key. Open, Busy, Idle and Waiters
+// are current values, the rest are totals since the pool was created.
+type PoolKeyStats struct {
+    Open         int                   `json:"open"`
+    Busy         int                   `json:"busy"`
+    Idle         int                   `json:"idle"`
+    Waiters      int                   `json:"waiters"`
+    MaxPerKey    int                   `json:"max_per_key"`
+    Dials        int64                 `json:"dials"`
+    DialFailures int64                 `json:"dial_failures"`
+    Reuses       int64                 `json:"reuses"`
+    Evictions    map[EvictReason]int64 `json:"evictions"`
+    Breaker      string                `json:"breaker"`
+    Wait         WaitHistogram         `json:"wait"`
+}
+
+type keyCounters struct {
+    dials        int64
+    dialFailures int64
+    reuses       int64
+    evictions    map[EvictReason]int64
+    waits        []int64
+    waitSum      time.Duration
+}
+
+func (k *keyCounters) evicted(r EvictReason) {
+    if k.evictions == nil { k.evictions = make(map[EvictReason]int64) }
+    k.evictions[r]++
+}
+
+func (k *keyCounters) reused(wait time.Duration) {
+    k.reuses++
+    k.waited(wait)
+}
+
+func (k *keyCounters) waited(d time.Duration) {
+    if k.waits == nil { k.waits = make([]int64, len(WaitBounds)+1) }
+    i := 0
+    for i < len(WaitBounds) && d > WaitBounds[i] { i++ }
+    k.waits[i]++
+    k.waitSum += d
+}
+
+// Stats returns the counters of every key the pool has seen.
+func (p *WSConnPool) Stats() map[string]PoolKeyStats {
+    p.mu.Lock()
+    kps := make(map[string]*keyPool, len(p.m))
+    for k, kp := range p.m { kps[k] = kp }
+    p.mu.Unlock()
+    out := make(map[string]PoolKeyStats, len(kps))
+    for k, kp := range kps {
+        kp.mu.Lock()
+        st := PoolKeyStats{Open: len(kp.entries), Waiters: len(kp.waiters), MaxPerKey: kp.limits.maxPerKey, Dials: kp.stats.dials, DialFailures: kp.stats.dialFailures, Reuses: kp.stats.reuses, Evictions: make(map[EvictReason]int64)}
+        for _, e := range kp.entries { if e.busy { st.Busy++ } }
+        st.Idle = st.Open - st.Busy
+        st.Breaker = kp.breaker.state(p.now())
+        for r, n := range kp.stats.evictions { st.Evictions[r] = n }
+        st.Wait = WaitHistogram{Bounds: WaitBounds, Counts: make([]int64, len(WaitBounds)+1), Sum: kp.stats.waitSum}
+        copy(st.Wait.Counts, kp.stats.waits)
+        kp.mu.Unlock()
+        out[k] = st
+    }
+    return out
+}
+
+// Handler serves Stats as JSON, keyed by pool key. Durations are nanoseconds.
+func (p *WSConnPool) Handler() http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        _ = json.NewEncoder(w).Encode(p.Stats())
+    })
+}
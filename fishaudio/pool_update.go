@@ -0,0 +1,45 @@
+package fishaudio
+
+// Update changes the pool's limits, TTLs and probing while it runs. Idle
+// connections above a lowered limit are closed now and leased ones when they
+// are released; room added by a raised limit goes to queued callers at once.
+// New TTLs apply from the next acquire or reap, a new ReapInterval after the
+// next reap. The clock cannot be changed.
+func (p *WSConnPool) Update(cfg PoolConfig) {
+    cfg.Clock = p.clock
+    cfg.normalize()
+    p.cfg.Store(&cfg)
+    defer p.flushHooks()
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.startProbeLocked()
+    for key, kp := range p.m {
+        kp.mu.Lock()
+        kp.limits = cfg.limitsFor(key)
+        max := kp.limits.maxPerKey
+        var closed []*poolEntry
+        for i := 0; i < len(kp.entries) && len(kp.entries) > max; i++ {
+            e := kp.entries[i]
+            if e.busy || e.probing { continue }
+            kp.remove1(e)
+            p.evicted(kp, EvictResize)
+            closed = append(closed, e)
+            i--
+        }
+        for room := max - len(kp.entries) - kp.dialing; room > 0 && kp.handoff(nil); room-- {}
+        kp.mu.Unlock()
+        for _, e := range closed {
+            _ = e.ws.Close()
+            delete(p.wsIndex, e.ws)
+            p.freeSlotLocked()
+        }
+    }
+    max := cfg.MaxTotalConns
+    for max > 0 && p.total > max && p.evictLRULocked(EvictResize) { p.total-- }
+    for len(p.gwaiters) > 0 && (max <= 0 || p.total < max) {
+        ch := p.gwaiters[0]
+        p.gwaiters = p.gwaiters[1:]
+        p.total++
+        ch <- struct{}{}
+    }
+}
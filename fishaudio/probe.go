@@ -0,0 +1,95 @@
+package fishaudio
+
+import (
+    "context"
+    "errors"
+    "time"
+    "github.com/gorilla/websocket"
+)
+
+var errProbeFailed = errors.New("pooled socket did not answer a ping")
+
+// probe pings an idle socket and waits up to timeout for the server to answer.
+// Nothing is read through the websocket, so the pong stays queued for the next
+// session's reader, which ignores it. It returns errProbeFailed for a dead
+// socket, or ctx's error if ctx ends first, in which case the socket's state
+// is unknown. It uses the system clock, since the deadline bounds socket I/O.
+func probe(ctx context.Context, ws *websocket.Conn, timeout time.Duration) error {
+    deadline := time.Now().Add(timeout)
+    // running into ctx's deadline is the caller's timeout, not a dead socket
+    expired := errProbeFailed
+    if d, ok := ctx.Deadline(); ok && d.Before(deadline) { deadline, expired = d, context.DeadlineExceeded }
+    queued, ok := peekSocket(ws)
+    if !ok { return errProbeFailed }
+    if err := ws.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+        if ctx.Err() != nil { return ctx.Err() }
+        return errProbeFailed
+    }
+    t := time.NewTicker(2 * time.Millisecond)
+    defer t.Stop()
+    for {
+        n, ok := peekSocket(ws)
+        if !ok { return errProbeFailed }
+        if n < 0 || n > queued { return nil }
+        if !time.Now().Before(deadline) { return expired }
+        select {
+        case <-t.C:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+}
+
+// startProbeLocked runs probeLoop when ProbeInterval is set and it is not
+// running yet; the caller holds p.mu.
+func (p *WSConnPool) startProbeLocked() {
+    if p.probeRunning || p.cfg.Load().ProbeInterval <= 0 { return }
+    p.probeRunning = true
+    go p.probeLoop()
+}
+
+// probeLoop checks idle sockets every ProbeInterval, picking up changes made
+// with Update. It stops once probing is turned off.
+func (p *WSConnPool) probeLoop() {
+    for {
+        p.sleep(p.cfg.Load().ProbeInterval)
+        p.mu.Lock()
+        if p.cfg.Load().ProbeInterval <= 0 {
+            p.probeRunning = false
+            p.mu.Unlock()
+            return
+        }
+        p.mu.Unlock()
+        p.probeIdle()
+    }
+}
+
+// probeIdle checks every idle socket, holding it back meanwhile so that it is
+// not handed out half-checked.
+func (p *WSConnPool) probeIdle() {
+    p.mu.Lock()
+    kps := make([]*keyPool, 0, len(p.m))
+    for _, kp := range p.m { kps = append(kps, kp) }
+    p.mu.Unlock()
+    for _, kp := range kps {
+        kp.mu.Lock()
+        var idle []*poolEntry
+        for _, e := range kp.entries {
+            if !e.busy && !e.probing {
+                e.probing = true
+                idle = append(idle, e)
+            }
+        }
+        kp.mu.Unlock()
+        for _, e := range idle {
+            if probe(context.Background(), e.ws, p.cfg.Load().ProbeTimeout) != nil {
+                p.evict(e, EvictDead)
+                continue
+            }
+            kp.mu.Lock()
+            e.probing = false
+            if kp.has(e) { kp.handoff(e) }
+            kp.mu.Unlock()
+        }
+    }
+}
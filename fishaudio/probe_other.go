@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package fishaudio
+
+import "github.com/gorilla/websocket"
+
+// peekSocket cannot look at the socket on this platform, so a successful ping
+// write is all the probe checks.
+func peekSocket(ws *websocket.Conn) (int, bool) { return -1, true }
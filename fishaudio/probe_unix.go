@@ -0,0 +1,41 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package fishaudio
+
+import (
+    "crypto/tls"
+    "syscall"
+    "github.com/gorilla/websocket"
+)
+
+// peekSocket reports how many bytes are waiting unread on the socket, without
+// consuming them. It is not ok once the server has closed or reset the
+// connection or its next frame is a close. n < 0 means the socket cannot be
+// inspected.
+func peekSocket(ws *websocket.Conn) (n int, ok bool) {
+    nc := ws.UnderlyingConn()
+    encrypted := false
+    if tc, isTLS := nc.(*tls.Conn); isTLS { nc, encrypted = tc.NetConn(), true }
+    sc, isSys := nc.(syscall.Conn)
+    if !isSys { return -1, true }
+    rc, err := sc.SyscallConn()
+    if err != nil { return -1, true }
+    var b [4096]byte
+    n, ok = -1, true
+    _ = rc.Read(func(fd uintptr) bool {
+        m, _, err := syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+        switch {
+        case err == syscall.EAGAIN || err == syscall.EINTR:
+            n = 0
+        case err != nil || m == 0:
+            ok = false
+        case encrypted:
+            // a TLS alert record is the server closing
+            n, ok = m, b[0] != 0x15
+        default:
+            n, ok = m, b[0]&0x0f != websocket.CloseMessage
+        }
+        return true
+    })
+    return n, ok
+}
@@ -3,26 +3,161 @@ package fishaudio
 import (
     "context"
     "crypto/tls"
+    "errors"
+    "net"
     "net/http"
     "strings"
+    "sync"
     "time"
-    "sync/atomic"
+    "unicode/utf8"
     "github.com/gorilla/websocket"
 )
 
+var ErrSessionClosed = errors.New("realtime session closed")
+var ErrSessionRestarting = errors.New("realtime session is restarting")
+var ErrSessionEnding = errors.New("realtime session is ending")
+
+// RealtimeConnection is one realtime synthesis session. Everything the session
+// produces is delivered on Events; the channel is closed once the session has
+// ended, after a FinishedEvent or an ErrorEvent.
 type RealtimeConnection struct {
-    Open  chan struct{}
-    Audio chan []byte
-    Packets chan []byte
-    Error chan error
-    Close chan struct{}
-    ws    *websocket.Conn
+    client   *Client
+    ctx      context.Context
+    req      TTSRequest
+    backend  string
+    key      string
+    cfg      realtimeConfig
+    open     func(key string) (*wsLease, error)
+    events   chan Event
+    frames   chan wsFrame
+    done     chan struct{}
+    quit     chan struct{}
+    quitOnce sync.Once
+    demux    *OggOpusDemux
+    samples  *sampleCounter
+    sendMu   sync.Mutex
+    mu       sync.Mutex
+    cur      *wsLease
+    queue    []*utterance
+    pending  []*utterance
+    wake     chan struct{}
+    kick     chan struct{}
+    notices  []Event
+    nextID   UtteranceID
+    audio    int64
+    attempts int
+    interrupting bool
+    ending   bool
+    ended    bool
+    finished bool
+    reconfig *reconfigReq
+    stats    statsRecorder
+    played   time.Duration
+    segByte  int64
+    segSample int64
+    completedN int
+    counts   TextCounts
+    space    chan struct{}
+    result   Result
+    endErr   error
+    err      error
+}
+
+type reconfigReq struct {
+    req  TTSRequest
+    errc chan error
+}
+
+// wsLease is one socket held by a session, together with its writer. A session
+// holds a single lease at a time and replaces it when it reconnects.
+type wsLease struct {
+    ws      *websocket.Conn
+    w       *wsWriter
     release func()
     force   func()
-    closed  uint32
+    acquire time.Duration
+    info    acquireInfo
+    once    sync.Once
+    err     error
+}
+
+type wsFrame struct {
+    l   *wsLease
+    ev  BaseEvent
+    raw []byte
+    err error
+}
+
+func (c *Client) ConvertRealtime(ctx context.Context, req TTSRequest, texts <-chan string, backend string, opts ...RealtimeOption) (*RealtimeConnection, error) {
+    rc := c.realtimeConfig(opts)
+    dial := c.liveDialer(ctx, backend, rc.handshake)
+    open := func(key string) (*wsLease, error) {
+        l := &wsLease{}
+        t0 := time.Now()
+        if rc.pooling {
+            p := c.Pool
+            e, info, err := p.acquire(ctx, key, dial, rc.acquireOptions()...)
+            if err != nil { return nil, err }
+            l.ws, l.info = e.ws, info
+            l.release = func() { p.release(e) }
+            l.force = func() { p.forceClose(e) }
+        } else {
+            w, _, err := dial()
+            if err != nil { return nil, err }
+            l.ws = w
+            l.info.Dial = time.Since(t0)
+            l.release = func() {}
+            l.force = func() { _ = w.Close() }
+        }
+        l.acquire = time.Since(t0)
+        l.w = newWSWriter(l.ws, c.Options.WSWriteTimeout, 0)
+        return l, nil
+    }
+    key := rc.suffixed(poolKey(c.BaseURL, backend, req))
+    l, err := open(key)
+    if err != nil { return nil, err }
+    var demux *OggOpusDemux
+    if !rc.noDemux { demux = newDemuxFor(req) }
+    eb := rc.audioBuf
+    if demux != nil { eb += rc.packetsBuf }
+    conn := &RealtimeConnection{client: c, ctx: ctx, req: req, backend: backend, key: key, cfg: rc, open: open, events: make(chan Event, eb), frames: make(chan wsFrame), done: make(chan struct{}), quit: make(chan struct{}), wake: make(chan struct{}, 1), space: make(chan struct{}, 1), kick: make(chan struct{}, 1), demux: demux, samples: newSampleCounter(req), cur: l}
+    conn.stats.st.Acquire, conn.stats.st.Dial, conn.stats.st.Reused = l.acquire, l.info.Dial, l.info.Reused
+    conn.stats.started = time.Now()
+    if err := l.w.Write(StartEvent{Event: "start", Request: req}); err != nil {
+        l.end(true)
+        return nil, err
+    }
+    go conn.pump(l)
+    go conn.run()
+    go conn.sendLoop()
+    if texts != nil && c.Options.CoalesceDelay > 0 { texts = coalesceTexts(texts, conn.done, c.Options.CoalesceDelay, c.Options.CoalesceMaxChars) }
+    go func() {
+        for {
+            var t string
+            var ok bool
+            select {
+            case t, ok = <-texts:
+            case <-conn.done:
+                return
+            }
+            if !ok {
+                _ = conn.End()
+                return
+            }
+            // a text Send refuses is reported and the channel kept drained,
+            // so the producer never blocks on a session that stopped reading
+            if _, err := conn.Send(t); err == ErrSessionClosed {
+                return
+            } else if err != nil {
+                conn.refused(t)
+            }
+        }
+    }()
+    return conn, nil
 }
 
-func (c *Client) ConvertRealtime(ctx context.Context, req TTSRequest, texts <-chan string, backend string) (*RealtimeConnection, error) {
+// liveDialer returns a dial func for the realtime endpoint of backend.
+func (c *Client) liveDialer(ctx context.Context, backend string, handshake time.Duration) func() (*websocket.Conn, *http.Response, error) {
     u := c.BaseURL
     if strings.HasPrefix(strings.ToLower(u), "https://") {
         u = "wss://" + strings.TrimPrefix(u, "https://")
@@ -30,97 +165,703 @@ func (c *Client) ConvertRealtime(ctx context.Context, req TTSRequest, texts <-ch
         u = "ws://" + strings.TrimPrefix(u, "http://")
     }
     u += "/v1/tts/live"
-    d := websocket.Dialer{HandshakeTimeout: 15 * time.Second, TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12}}
+    d := websocket.Dialer{HandshakeTimeout: handshake, TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12}}
     h := http.Header{}
     h.Set("Authorization", "Bearer "+c.APIKey)
     h.Set("model", backend)
-    key := c.BaseURL + "|" + strings.ToLower(backend) + "|"
+    return func() (*websocket.Conn, *http.Response, error) { return d.DialContext(ctx, u, h) }
+}
+
+func poolKey(baseURL, backend string, req TTSRequest) string {
+    key := baseURL + "|" + strings.ToLower(backend) + "|"
     if req.Format != nil { key += strings.ToLower(*req.Format) }
     key += "|"
     if req.ReferenceID != nil { key += *req.ReferenceID }
-    var ws *websocket.Conn
-    var release func()
-    var force func()
-    if c.Options.DefaultPooling && c.Pool != nil {
-        w, r, f, err := c.Pool.Acquire(ctx, key, func() (*websocket.Conn, *http.Response, error) { return d.DialContext(ctx, u, h) })
-        if err != nil { return nil, err }
-        ws, release, force = w, r, f
-    } else {
-        w, _, err := d.DialContext(ctx, u, h)
-        if err != nil { return nil, err }
-        ws = w
-        release = func() {}
-        force = func() { _ = ws.Close() }
-    }
-    ab := c.Options.AudioBuf
-    pb := c.Options.PacketsBuf
-    if ab <= 0 { ab = 256 }
-    if pb <= 0 { pb = 1024 }
-    conn := &RealtimeConnection{Open: make(chan struct{}, 1), Audio: make(chan []byte, ab), Packets: make(chan []byte, pb), Error: make(chan error, 1), Close: make(chan struct{}, 1), ws: ws, release: release, force: force}
-    conn.Open <- struct{}{}
-    _ = writeEvent(ws, StartEvent{Event: "start", Request: req})
-    go func() {
-        for t := range texts {
-            if err := writeEvent(ws, TextEvent{Event: "text", Text: t}); err != nil {
-                if isAbnormalCloseError(err) { conn.ForceClose() ; return }
-                select { case conn.Error <- err: default: }
-                return
-            }
-            if c.Pool != nil { c.Pool.TouchText(ws) }
-            if err := writeEvent(ws, FlushEvent{Event: "flush"}); err != nil {
-                if isAbnormalCloseError(err) { conn.ForceClose() ; return }
-                select { case conn.Error <- err: default: }
-                return
+    return key
+}
+
+func newDemuxFor(req TTSRequest) *OggOpusDemux {
+    if req.Format != nil && strings.ToLower(*req.Format) == "opus" { return NewOggOpusDemux() }
+    return nil
+}
+
+func (l *wsLease) end(force bool) {
+    l.once.Do(func() {
+        l.w.Close()
+        if force {
+            l.force()
+            return
+        }
+        _ = l.ws.SetReadDeadline(time.Time{})
+        l.release()
+    })
+}
+
+func (c *RealtimeConnection) lease() *wsLease {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.cur
+}
+
+// pump reads frames from one socket until it fails or the server finishes.
+func (c *RealtimeConnection) pump(l *wsLease) {
+    for {
+        f := wsFrame{l: l}
+        if c.cfg.read > 0 { _ = l.ws.SetReadDeadline(c.readDeadline()) }
+        _, f.raw, f.err = l.ws.ReadMessage()
+        if f.err == nil { f.err = decodeEvent(f.raw, &f.ev) }
+        select {
+        case c.frames <- f:
+        case <-c.done:
+            return
+        }
+        if f.err != nil || f.ev.Event == "finish" { return }
+    }
+}
+
+// readDeadline bounds the next read while the session waits for audio or
+// finish; an idle session may read without a deadline.
+func (c *RealtimeConnection) readDeadline() time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if len(c.pending) == 0 && !c.ending && !c.interrupting && c.reconfig == nil { return time.Time{} }
+    return time.Now().Add(c.cfg.read)
+}
+
+// armRead starts the read timeout after a flush or stop has been written.
+func (c *RealtimeConnection) armRead(l *wsLease) {
+    if c.cfg.read > 0 { _ = l.ws.SetReadDeadline(time.Now().Add(c.cfg.read)) }
+}
+
+func (c *RealtimeConnection) run() {
+    defer close(c.events)
+    defer close(c.done)
+    defer func() { c.lease().w.Close() }()
+    c.emit(OpenedEvent{})
+    gapTimer := time.NewTimer(time.Hour)
+    gapTimer.Stop()
+    ctxDone := c.ctx.Done()
+    stall, stallC := stallTicker(c.client.Options.StallTimeout)
+    if stall != nil { defer stall.Stop() }
+    for {
+        var f wsFrame
+        select {
+        case f = <-c.frames:
+        case <-c.kick:
+            c.emitNotices()
+            continue
+        case now := <-gapTimer.C:
+            d, u := c.completeQuiet(now)
+            if u != nil { c.emit(u.completed()) }
+            if d > 0 { gapTimer.Reset(d) }
+            continue
+        case now := <-stallC:
+            serr := c.checkStall(now)
+            if serr == nil { continue }
+            if c.client.Options.StallRedial && c.attempts < c.client.Options.ReconnectAttempts {
+                c.emit(StallEvent{Err: serr})
+                c.lease().end(true)
+                if err := c.reconnect(); err != nil {
+                    c.fail(err)
+                    c.conclude("", "", err)
+                    return
+                }
+                continue
             }
+            c.fail(serr)
+            continue
+        case <-ctxDone:
+            ctxDone = nil
+            c.fail(c.ctx.Err())
+            continue
         }
-    }()
-    go func() {
-        defer func() { if atomic.CompareAndSwapUint32(&conn.closed, 0, 1) { close(conn.Close) } }()
-        var demux *OggOpusDemux
-        if req.Format != nil {
-            f := strings.ToLower(*req.Format)
-            if f == "opus" { demux = NewOggOpusDemux() }
+        if f.l != c.lease() { continue }
+        if f.err != nil {
+            err := c.failure()
+            writeErr := false
+            if err == nil {
+                c.mu.Lock()
+                err = f.err
+                if f.l.err != nil { err, writeErr = f.l.err, true }
+                c.mu.Unlock()
+            }
+            f.l.end(true)
+            if c.failure() == nil && c.shouldReconnect(err, writeErr) {
+                if rerr := c.reconnect(); rerr == nil { continue } else { err = rerr }
+            }
+            c.conclude("", "", err)
+            return
         }
-        for {
-            _, data, err := ws.ReadMessage()
-            if err != nil {
-                if isAbnormalCloseError(err) { conn.ForceClose() ; return }
-                select { case conn.Error <- err: default: }
-                return
+        switch f.ev.Event {
+        case "audio":
+            if f.ev.Audio == nil { continue }
+            if gap := c.client.Options.UtteranceGap; gap > 0 { gapTimer.Reset(gap) }
+            c.handleAudio(f.ev.Audio, time.Now())
+        case "finish":
+            c.mu.Lock()
+            restart := (c.interrupting || c.reconfig != nil) && f.ev.Reason != "error"
+            // an error finish completes nothing. Otherwise an utterance was
+            // answered if audio was tied to it or, where boundaries are only
+            // inferred, if any audio arrived after its flush.
+            var evs []Event
+            for _, u := range c.pending {
+                answered := u.bytes > 0 || u.inferred && !u.flushed.IsZero() && c.stats.lastChunk.After(u.flushed)
+                if !answered || f.ev.Reason == "error" {
+                    evs = append(evs, c.unconfirm(u))
+                    continue
+                }
+                if !u.started { u.startByte, u.startSample, u.endByte, u.endSample = c.audio, c.samples.samples, c.audio, c.samples.samples }
+                c.confirm(u)
+                evs = append(evs, u.completed())
             }
-            var ev BaseEvent
-            if err := decodeEvent(data, &ev); err != nil { select { case conn.Error <- err: default: } ; return }
-            if ev.Event == "audio" {
-                if ev.Audio != nil {
-                    conn.Audio <- ev.Audio
-                    if demux != nil { for _, p := range demux.Push(ev.Audio) { conn.Packets <- p } }
+            c.pending = nil
+            c.mu.Unlock()
+            for _, ev := range evs { c.emit(ev) }
+            if restart {
+                if err := c.restart(f.l); err != nil {
+                    c.fail(err)
+                    c.conclude("", "", err)
+                    return
                 }
-            } else if ev.Event == "finish" {
-                if ev.Reason == "error" { select { case conn.Error <- &finishError{ev.Message}: default: } }
-                if demux != nil { close(conn.Packets) }
-                return
+                continue
             }
+            c.mu.Lock()
+            c.finished = true
+            c.mu.Unlock()
+            var err error
+            if f.ev.Reason == "error" { err = &ServerError{Message: f.ev.Message} }
+            c.conclude(f.ev.Reason, f.ev.Message, err)
+            return
+        case "log":
+            c.emit(ServerLogEvent{Message: f.ev.Message})
+        default:
+            c.emit(UnknownEvent{Name: f.ev.Event, Raw: f.raw})
         }
-    }()
-    return conn, nil
+    }
+}
+
+// emit delivers an event, giving up once the context is done or the caller
+// has let go of the session with Release or ForceClose.
+func (c *RealtimeConnection) emit(ev Event) {
+    select {
+    case c.events <- ev:
+    case <-c.ctx.Done():
+    case <-c.quit:
+    }
 }
 
-type finishError struct{ s string }
-func (e *finishError) Error() string { return e.s }
+// emitFinal delivers one of the events that end the session. Unlike emit it
+// does not give up on a cancelled context, since ending with an ErrorEvent is
+// how the caller learns about the cancellation.
+func (c *RealtimeConnection) emitFinal(ev Event) {
+    select {
+    case c.events <- ev:
+    case <-c.quit:
+    }
+}
+
+func (c *RealtimeConnection) abandon() { c.quitOnce.Do(func() { close(c.quit) }) }
+
+func (c *RealtimeConnection) emitNotices() {
+    c.mu.Lock()
+    evs := c.notices
+    c.notices = nil
+    c.mu.Unlock()
+    for _, ev := range evs { c.emit(ev) }
+}
 
-func (c *RealtimeConnection) Release() { if c.release != nil { c.release() } }
+// Send queues a text for synthesis and returns the id its audio is tagged
+// with. Queued texts are written with a flush each, in order, by the session.
+// When Options.SendQueueLimit texts are waiting, Options.SendOverflow applies.
+func (c *RealtimeConnection) Send(t string) (UtteranceID, error) {
+    limit := c.client.Options.SendQueueLimit
+    for {
+        select {
+        case <-c.done:
+            return 0, ErrSessionClosed
+        default:
+        }
+        c.mu.Lock()
+        if c.ended {
+            c.mu.Unlock()
+            return 0, ErrSessionEnding
+        }
+        if limit <= 0 || c.queued() < limit { break }
+        switch c.client.Options.SendOverflow {
+        case OverflowError:
+            c.mu.Unlock()
+            return 0, ErrQueueFull
+        case OverflowDropOldest:
+            c.dropOldest()
+            select {
+            case c.kick <- struct{}{}:
+            default:
+            }
+        default:
+            c.mu.Unlock()
+            select {
+            case <-c.space:
+            case <-c.done:
+            }
+            continue
+        }
+        break
+    }
+    c.nextID++
+    u := &utterance{id: c.nextID, text: t}
+    c.queue = append(c.queue, u)
+    c.counts.Queued += int64(utf8.RuneCountInString(t))
+    c.mu.Unlock()
+    select {
+    case c.wake <- struct{}{}:
+    default:
+    }
+    return u.id, nil
+}
+
+// End sends stop once every queued text has been written, so the session
+// finishes after their audio. Send fails with ErrSessionEnding afterwards.
+// Closing the texts channel calls End.
+func (c *RealtimeConnection) End() error {
+    select {
+    case <-c.done:
+        return ErrSessionClosed
+    default:
+    }
+    c.mu.Lock()
+    if c.ended {
+        c.mu.Unlock()
+        return nil
+    }
+    c.ended = true
+    c.queue = append(c.queue, &utterance{stop: true})
+    c.mu.Unlock()
+    select {
+    case c.wake <- struct{}{}:
+    default:
+    }
+    return nil
+}
+
+func (c *RealtimeConnection) sendLoop() {
+    for {
+        sent, err := c.sendNext()
+        if err != nil { return }
+        if sent { continue }
+        select {
+        case <-c.wake:
+        case <-c.done:
+            return
+        }
+    }
+}
+
+// sendNext writes the next queued text and its flush on the current socket.
+// Sends are serialized with reconnects and interrupts so texts keep their order.
+func (c *RealtimeConnection) sendNext() (bool, error) {
+    c.sendMu.Lock()
+    defer c.sendMu.Unlock()
+    c.mu.Lock()
+    if c.interrupting || c.reconfig != nil || len(c.queue) == 0 {
+        c.mu.Unlock()
+        return false, nil
+    }
+    u := c.queue[0]
+    c.queue = c.queue[1:]
+    l := c.cur
+    if u.stop {
+        c.ending = true
+        c.mu.Unlock()
+        if err := l.w.Write(StopEvent{Event: "stop"}); err != nil { return true, c.writeFailed(l, err) }
+        c.armRead(l)
+        return true, nil
+    }
+    c.pending = append(c.pending, u)
+    c.mu.Unlock()
+    select {
+    case c.space <- struct{}{}:
+    default:
+    }
+    n := int64(utf8.RuneCountInString(u.text))
+    if err := l.w.Write(TextEvent{Event: "text", Text: u.text}); err != nil { return true, c.writeFailed(l, err) }
+    if c.client.Pool != nil { c.client.Pool.TouchText(l.ws) }
+    c.mu.Lock()
+    c.counts.Sent += n
+    c.mu.Unlock()
+    // mark the flush before writing it, so its first audio always finds it
+    c.mu.Lock()
+    u.flushed = time.Now()
+    u.inferred = !segmented(c.samples.format)
+    c.mu.Unlock()
+    if err := l.w.Write(FlushEvent{Event: "flush"}); err != nil { return true, c.writeFailed(l, err) }
+    c.armRead(l)
+    c.mu.Lock()
+    c.counts.Flushed += n
+    c.mu.Unlock()
+    return true, nil
+}
+
+// Interrupt cuts the current speech: queued texts are dropped, stop is sent and
+// audio still in flight is discarded until the server finishes, after which the
+// session starts again on the same socket. An InterruptedEvent marks the cut.
+func (c *RealtimeConnection) Interrupt() error {
+    select {
+    case <-c.done:
+        return ErrSessionClosed
+    default:
+    }
+    c.sendMu.Lock()
+    defer c.sendMu.Unlock()
+    c.mu.Lock()
+    if c.interrupting {
+        c.mu.Unlock()
+        return nil
+    }
+    if c.reconfig != nil {
+        c.mu.Unlock()
+        return ErrSessionRestarting
+    }
+    ev := InterruptedEvent{ByteOffset: c.audio, SampleOffset: c.samples.samples}
+    if len(c.pending) > 0 && c.pending[0].started { ev.Utterance = c.pending[0].id }
+    var ends []*utterance
+    for _, u := range append(c.pending, c.queue...) {
+        if u.stop {
+            ends = append(ends, u)
+            continue
+        }
+        ev.Cancelled = append(ev.Cancelled, u.id)
+        c.counts.Cancelled += int64(utf8.RuneCountInString(u.text))
+    }
+    c.pending, c.queue = nil, ends
+    c.interrupting = true
+    select {
+    case c.space <- struct{}{}:
+    default:
+    }
+    c.notices = append(c.notices, ev)
+    l := c.cur
+    c.mu.Unlock()
+    select {
+    case c.kick <- struct{}{}:
+    default:
+    }
+    if err := l.w.WriteControl(StopEvent{Event: "stop"}); err != nil { return err }
+    c.armRead(l)
+    return nil
+}
+
+// Reconfigure finishes the synthesis of the texts already sent and starts
+// again on the same socket with req, which may change the voice, prosody,
+// latency or format. Texts queued meanwhile are synthesized with the new
+// request. It returns once the new start has been sent.
+func (c *RealtimeConnection) Reconfigure(ctx context.Context, req TTSRequest) error {
+    select {
+    case <-c.done:
+        return ErrSessionClosed
+    default:
+    }
+    r := &reconfigReq{req: req, errc: make(chan error, 1)}
+    c.sendMu.Lock()
+    c.mu.Lock()
+    if c.interrupting || c.reconfig != nil {
+        c.mu.Unlock()
+        c.sendMu.Unlock()
+        return ErrSessionRestarting
+    }
+    c.reconfig = r
+    l := c.cur
+    c.mu.Unlock()
+    err := l.w.Write(StopEvent{Event: "stop"})
+    if err == nil { c.armRead(l) }
+    c.sendMu.Unlock()
+    if err != nil { return err }
+    select {
+    case err := <-r.errc:
+        return err
+    case <-c.done:
+        if err := c.failure(); err != nil { return err }
+        return ErrSessionClosed
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// applyRequest switches the session to req; the caller holds c.mu.
+func (c *RealtimeConnection) applyRequest(req TTSRequest) {
+    c.played += c.segmentDuration()
+    c.segByte, c.segSample = c.audio, c.samples.samples
+    c.req = req
+    c.key = c.cfg.suffixed(poolKey(c.client.BaseURL, c.backend, req))
+    c.demux = nil
+    if !c.cfg.noDemux { c.demux = newDemuxFor(req) }
+    c.samples.format = newSampleCounter(req).format
+}
+
+// restart sends start again on the socket once an interrupt or a
+// reconfiguration has finished and lets queued texts flow.
+func (c *RealtimeConnection) restart(l *wsLease) error {
+    c.emitNotices()
+    c.mu.Lock()
+    r := c.reconfig
+    if r != nil { c.applyRequest(r.req) }
+    c.mu.Unlock()
+    if r != nil && c.client.Pool != nil { c.client.Pool.Rekey(l.ws, c.key) }
+    if c.demux != nil { c.demux.Reset() }
+    err := l.w.Write(StartEvent{Event: "start", Request: c.req})
+    if r != nil { r.errc <- err }
+    if err != nil { return err }
+    go c.pump(l)
+    c.mu.Lock()
+    if c.ending {
+        c.ending = false
+        c.queue = append(c.queue, &utterance{stop: true})
+    }
+    c.interrupting = false
+    c.reconfig = nil
+    c.samples.odd = false
+    c.mu.Unlock()
+    select {
+    case c.wake <- struct{}{}:
+    default:
+    }
+    return nil
+}
+
+// writeFailed decides what a failed text write means. The text stays pending,
+// so when the session reconnects it is replayed on the new socket.
+func (c *RealtimeConnection) writeFailed(l *wsLease, err error) error {
+    if err == ErrWriterClosed { return nil }
+    if c.client.Options.ReconnectAttempts > 0 {
+        c.mu.Lock()
+        if l.err == nil { l.err = err }
+        c.mu.Unlock()
+        l.end(true)
+        return nil
+    }
+    c.fail(err)
+    return err
+}
+
+// handleAudio attributes an audio chunk to the oldest flushed utterance and
+// emits it with its offsets. An utterance is complete once the answer to the
+// next flush starts (wav and opus) or its audio has been quiet for
+// UtteranceGap.
+func (c *RealtimeConnection) handleAudio(data []byte, now time.Time) {
+    c.mu.Lock()
+    if c.interrupting {
+        c.mu.Unlock()
+        return
+    }
+    var packets [][]byte
+    if c.demux != nil { packets = c.demux.Push(data) }
+    var evs []Event
+    gap := c.client.Options.UtteranceGap
+    next := segmentStart(c.samples.format, data)
+    for len(c.pending) > 0 {
+        u := c.pending[0]
+        if u.bytes == 0 || !next && (gap <= 0 || now.Sub(u.lastAudio) < gap) { break }
+        c.pending = c.pending[1:]
+        c.confirm(u)
+        evs = append(evs, u.completed())
+    }
+    var u *utterance
+    if len(c.pending) > 0 && !c.pending[0].flushed.IsZero() {
+        u = c.pending[0]
+        u.bytes += len(data)
+        u.lastAudio = now
+    }
+    drop := u != nil && u.replayed && c.client.Options.DropReplayedAudio
+    ev := AudioEvent{Data: data, ByteOffset: c.audio, SampleOffset: c.samples.samples}
+    if drop {
+        u.discarded += int64(len(data))
+    } else {
+        c.audio += int64(len(data))
+        c.samples.add(data, packets)
+        c.stats.chunk(len(data), now)
+    }
+    if u != nil {
+        ev.Utterance, ev.Replayed = u.id, u.replayed
+        if !u.started && !drop {
+            if !u.timed {
+                u.timed = true
+                c.stats.st.Flushes = append(c.stats.st.Flushes, FlushLatency{Utterance: u.id, FirstAudio: now.Sub(u.flushed)})
+            }
+            u.started = true
+            u.startByte, u.startSample = ev.ByteOffset, ev.SampleOffset
+            evs = append(evs, UtteranceStartedEvent{ID: u.id, Text: u.text, ByteOffset: ev.ByteOffset, SampleOffset: ev.SampleOffset, Replayed: u.replayed, Inferred: u.inferred})
+        }
+        if !drop { u.endByte, u.endSample = c.audio, c.samples.samples }
+    }
+    c.mu.Unlock()
+    for _, e := range evs { c.emit(e) }
+    if drop { return }
+    c.emit(ev)
+    for _, p := range packets { c.emit(OpusPacketEvent{Data: p}) }
+}
+
+// completeQuiet completes the oldest utterance once its audio has been quiet
+// for UtteranceGap and returns how long to wait before checking again.
+func (c *RealtimeConnection) completeQuiet(now time.Time) (time.Duration, *utterance) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    gap := c.client.Options.UtteranceGap
+    if gap <= 0 || len(c.pending) == 0 { return 0, nil }
+    u := c.pending[0]
+    if u.bytes == 0 { return 0, nil }
+    if d := gap - now.Sub(u.lastAudio); d > 0 { return d, nil }
+    c.pending = c.pending[1:]
+    c.confirm(u)
+    return 0, u
+}
+
+func (c *RealtimeConnection) shouldReconnect(err error, writeErr bool) bool {
+    if c.attempts >= c.client.Options.ReconnectAttempts { return false }
+    if writeErr || isAbnormalCloseError(err) { return true }
+    var ne net.Error
+    return errors.As(err, &ne) && ne.Timeout()
+}
+
+// reconnect dials a new socket through the pool, sends start again with the
+// same request and replays every text that has not been confirmed by audio.
+// sendMu is held while dialing and replaying only, since emitting can block on
+// a consumer that is calling Interrupt or Reconfigure.
+func (c *RealtimeConnection) reconnect() error {
+    c.sendMu.Lock()
+    var n int
+    var err error
+    ok := false
+    for !ok && c.attempts < c.client.Options.ReconnectAttempts {
+        c.attempts++
+        if c.attempts > 1 {
+            select {
+            case <-time.After(time.Duration(c.attempts-1) * 200 * time.Millisecond):
+            case <-c.ctx.Done():
+                c.sendMu.Unlock()
+                return c.ctx.Err()
+            }
+        }
+        n, err = c.redial()
+        ok = err == nil
+        // a session closed meanwhile is not redialed again
+        if !ok && c.failure() != nil { break }
+    }
+    c.sendMu.Unlock()
+    if !ok { return err }
+    c.mu.Lock()
+    c.stats.st.Reconnects++
+    c.mu.Unlock()
+    c.emit(ReconnectedEvent{Attempt: c.attempts, Replayed: n})
+    return nil
+}
+
+func (c *RealtimeConnection) redial() (int, error) {
+    c.mu.Lock()
+    r := c.reconfig
+    if r != nil { c.applyRequest(r.req) }
+    key := c.key
+    c.mu.Unlock()
+    l, err := c.open(key)
+    if err != nil { return 0, err }
+    c.mu.Lock()
+    // ForceClose or Release during the dial ended the old socket only
+    if err := c.err; err != nil {
+        c.mu.Unlock()
+        l.end(true)
+        return 0, err
+    }
+    c.cur = l
+    replay := append(append([]*utterance(nil), c.pending...), c.queue...)
+    if c.ending && len(c.queue) == 0 { replay = append(replay, &utterance{stop: true}) }
+    c.pending = c.pending[:0]
+    for _, u := range replay { if !u.stop { c.pending = append(c.pending, u) } }
+    n := len(c.pending)
+    c.queue = nil
+    c.interrupting = false
+    for _, u := range replay {
+        if u.bytes > 0 { u.replayed = true }
+        // with DropReplayedAudio the replay is discarded whole, so the
+        // utterance keeps the start it had before the reconnect
+        if !u.replayed || !c.client.Options.DropReplayedAudio { u.started = false }
+        u.bytes = 0
+        u.flushed = time.Time{}
+    }
+    c.mu.Unlock()
+    if c.demux != nil { c.demux.Reset() }
+    if err := l.w.Write(StartEvent{Event: "start", Request: c.req}); err != nil {
+        l.end(true)
+        return 0, err
+    }
+    if r != nil {
+        c.mu.Lock()
+        c.reconfig = nil
+        c.mu.Unlock()
+        r.errc <- nil
+    }
+    for _, u := range replay {
+        if u.stop {
+            if err := l.w.Write(StopEvent{Event: "stop"}); err != nil { l.end(true); return 0, err }
+            continue
+        }
+        if err := l.w.Write(TextEvent{Event: "text", Text: u.text}); err != nil { l.end(true); return 0, err }
+        c.mu.Lock()
+        u.flushed = time.Now()
+        u.inferred = !segmented(c.samples.format)
+        c.mu.Unlock()
+        if err := l.w.Write(FlushEvent{Event: "flush"}); err != nil { l.end(true); return 0, err }
+    }
+    go c.pump(l)
+    return n, nil
+}
+
+// fail records the first session error and closes the socket so that the
+// session ends with it.
+func (c *RealtimeConnection) fail(err error) {
+    c.mu.Lock()
+    if c.err == nil { c.err = err }
+    l := c.cur
+    c.mu.Unlock()
+    _ = l.w.WriteControl(StopEvent{Event: "stop"})
+    l.end(true)
+}
+
+func (c *RealtimeConnection) failure() error {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.err
+}
+
+func (c *RealtimeConnection) Events() <-chan Event { return c.events }
+
+// Release returns the socket to the pool. A session that has not finished yet
+// leaves the socket in an unknown state, so it is force closed instead.
+func (c *RealtimeConnection) Release() {
+    c.mu.Lock()
+    finished := c.finished
+    c.mu.Unlock()
+    if !finished {
+        select {
+        case <-c.done:
+        default:
+            c.ForceClose()
+            return
+        }
+    }
+    c.abandon()
+    <-c.done
+    c.lease().end(false)
+}
 
 func (c *RealtimeConnection) ForceClose() {
-    _ = writeEvent(c.ws, StopEvent{Event: "stop"})
-    if c.force != nil { c.force() }
+    c.fail(ErrSessionClosed)
+    c.abandon()
 }
 
-func (c *RealtimeConnection) DoneCh() <-chan struct{} { return c.Close }
+func (c *RealtimeConnection) DoneCh() <-chan struct{} { return c.done }
 
-func (c *RealtimeConnection) Stop() { _ = writeEvent(c.ws, StopEvent{Event: "stop"}) }
+func (c *RealtimeConnection) Stop() error { return c.lease().w.WriteControl(StopEvent{Event: "stop"}) }
 
 func isAbnormalCloseError(err error) bool {
     if err == nil { return false }
     s := err.Error()
     return strings.Contains(s, "close 1006") || strings.Contains(s, "close 1005") || strings.Contains(s, "unexpected EOF")
-}
\ No newline at end of file
+}
@@ -50,4 +50,107 @@ func writeEvent(ws *websocket.Conn, v interface{}) error {
 
 func decodeEvent(data []byte, out *BaseEvent) error {
     return msgpack.Unmarshal(data, out)
-}
\ No newline at end of file
+}
+
+type Event interface{ realtimeEvent() }
+
+type OpenedEvent struct{}
+
+// AudioEvent carries one audio chunk. Replayed is set for audio of a text that
+// was already partly delivered before a reconnect, so it may repeat speech.
+// Utterance is zero when the chunk could not be tied to a sent text. Offsets
+// count from the start of the session; SampleOffset is only tracked for pcm,
+// wav and opus (48kHz).
+type AudioEvent struct {
+    Data         []byte
+    Replayed     bool
+    Utterance    UtteranceID
+    ByteOffset   int64
+    SampleOffset int64
+}
+
+// UtteranceStartedEvent marks the first audio of an utterance. Inferred is set
+// when the format has no per-flush header (mp3, pcm): the boundary is then
+// guessed from Options.UtteranceGap and may be wrong for texts flushed
+// back-to-back.
+type UtteranceStartedEvent struct {
+    ID           UtteranceID
+    Text         string
+    ByteOffset   int64
+    SampleOffset int64
+    Replayed     bool
+    Inferred     bool
+}
+
+// UtteranceCompletedEvent marks the end of an utterance's audio. The protocol
+// has no per-flush acknowledgement. For wav and opus the answer to each flush
+// starts with its own header, so an utterance completes when the next one
+// starts; otherwise, and for the last utterance, completion follows a silence
+// of Options.UtteranceGap or the server finish. Inferred is set as on
+// UtteranceStartedEvent; the offsets of an inferred utterance that got no
+// audio of its own are empty at the end of the stream. Discarded is the number of
+// replayed bytes dropped by Options.DropReplayedAudio; the offsets then cover
+// only the audio delivered before the reconnect.
+type UtteranceCompletedEvent struct {
+    ID           UtteranceID
+    ByteOffset   int64
+    ByteEnd      int64
+    SampleOffset int64
+    SampleEnd    int64
+    Discarded    int64
+    Inferred     bool
+}
+
+type OpusPacketEvent struct {
+    Data []byte
+}
+
+type FinishedEvent struct {
+    Reason  string
+    Message string
+}
+
+type ServerLogEvent struct {
+    Message string
+}
+
+type UnknownEvent struct {
+    Name string
+    Raw  []byte
+}
+
+type ErrorEvent struct {
+    Err error
+}
+
+// InterruptedEvent marks where Interrupt cut the audio stream. Utterance is
+// the utterance that was speaking, if any; Cancelled lists every utterance
+// that will not be synthesized.
+type InterruptedEvent struct {
+    Utterance    UtteranceID
+    ByteOffset   int64
+    SampleOffset int64
+    Cancelled    []UtteranceID
+}
+
+// ReconnectedEvent is emitted after an abnormal close once the session has
+// redialed and replayed its unconfirmed texts.
+type ReconnectedEvent struct {
+    Attempt  int
+    Replayed int
+}
+
+func (OpenedEvent) realtimeEvent()     {}
+func (AudioEvent) realtimeEvent()      {}
+func (OpusPacketEvent) realtimeEvent() {}
+func (FinishedEvent) realtimeEvent()   {}
+func (ServerLogEvent) realtimeEvent()  {}
+func (UnknownEvent) realtimeEvent()    {}
+func (ErrorEvent) realtimeEvent()      {}
+func (ReconnectedEvent) realtimeEvent() {}
+func (InterruptedEvent) realtimeEvent()        {}
+func (UtteranceStartedEvent) realtimeEvent()   {}
+func (UtteranceCompletedEvent) realtimeEvent() {}
+
+// Decode unmarshals the raw server frame into v.
+func (e UnknownEvent) Decode(v interface{}) error { return msgpack.Unmarshal(e.Raw, v) }
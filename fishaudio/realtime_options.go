@@ -0,0 +1,75 @@
+package fishaudio
+
+import "time"
+
+// RealtimeOption overrides a client-wide setting for one ConvertRealtime call.
+type RealtimeOption func(*realtimeConfig)
+
+type realtimeConfig struct {
+    pooling    bool
+    audioBuf   int
+    packetsBuf int
+    keySuffix  string
+    noDemux    bool
+    handshake  time.Duration
+    read       time.Duration
+    prio       int
+    wait       time.Duration
+}
+
+// WithoutPooling dials a dedicated socket that is closed when the session ends.
+func WithoutPooling() RealtimeOption { return func(rc *realtimeConfig) { rc.pooling = false } }
+
+// WithAudioBuf sets the size of the event buffer for audio.
+func WithAudioBuf(n int) RealtimeOption { return func(rc *realtimeConfig) { rc.audioBuf = n } }
+
+// WithPacketsBuf sets the extra event buffer for opus packets.
+func WithPacketsBuf(n int) RealtimeOption { return func(rc *realtimeConfig) { rc.packetsBuf = n } }
+
+// WithPoolKeySuffix appends "|"+s to the pool key, so sessions with the same
+// request but a different suffix never share sockets. KeyPolicy matching
+// ignores the suffix.
+func WithPoolKeySuffix(s string) RealtimeOption { return func(rc *realtimeConfig) { rc.keySuffix = s } }
+
+// suffixed returns key with the WithPoolKeySuffix suffix, if any.
+func (rc *realtimeConfig) suffixed(key string) string {
+    if rc.keySuffix == "" { return key }
+    return key + "|" + rc.keySuffix
+}
+
+// WithoutOpusDemux delivers opus audio as raw Ogg pages only, without
+// OpusPacketEvents. Sample offsets and durations are then not counted.
+func WithoutOpusDemux() RealtimeOption { return func(rc *realtimeConfig) { rc.noDemux = true } }
+
+// WithHandshakeTimeout bounds the websocket handshake of a fresh dial.
+func WithHandshakeTimeout(d time.Duration) RealtimeOption { return func(rc *realtimeConfig) { rc.handshake = d } }
+
+// WithReadTimeout bounds each read while the session is waiting for audio or
+// finish; zero disables it.
+func WithReadTimeout(d time.Duration) RealtimeOption { return func(rc *realtimeConfig) { rc.read = d } }
+
+// WithAcquirePriority serves the session before lower-priority sessions
+// waiting for a socket on a full pool key.
+func WithAcquirePriority(n int) RealtimeOption { return func(rc *realtimeConfig) { rc.prio = n } }
+
+// WithAcquireTimeout bounds each wait for a socket on a full pool key.
+func WithAcquireTimeout(d time.Duration) RealtimeOption { return func(rc *realtimeConfig) { rc.wait = d } }
+
+// defaultHandshakeTimeout bounds the websocket handshake unless
+// WithHandshakeTimeout says otherwise.
+const defaultHandshakeTimeout = 15 * time.Second
+
+func (c *Client) realtimeConfig(opts []RealtimeOption) realtimeConfig {
+    rc := realtimeConfig{pooling: c.Options.DefaultPooling && c.Pool != nil, audioBuf: c.Options.AudioBuf, packetsBuf: c.Options.PacketsBuf, handshake: defaultHandshakeTimeout, read: c.Options.WSReadTimeout}
+    for _, o := range opts { o(&rc) }
+    if c.Pool == nil { rc.pooling = false }
+    if rc.audioBuf <= 0 { rc.audioBuf = 256 }
+    if rc.packetsBuf <= 0 { rc.packetsBuf = 1024 }
+    return rc
+}
+
+func (rc realtimeConfig) acquireOptions() []AcquireOption {
+    opts := []AcquireOption{AcquirePriority(rc.prio)}
+    if rc.wait > 0 { opts = append(opts, AcquireDeadline(time.Now().Add(rc.wait))) }
+    return opts
+}
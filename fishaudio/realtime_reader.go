@@ -0,0 +1,43 @@
+package fishaudio
+
+import "io"
+
+type audioReader struct {
+    conn *RealtimeConnection
+    buf  []byte
+    err  error
+}
+
+// AudioReader returns the session audio as a byte stream. It consumes Events, so
+// use either the reader or the event channel, not both. Read returns io.EOF
+// after a normal finish and the session error otherwise; Close releases the
+// connection.
+func (c *RealtimeConnection) AudioReader() io.ReadCloser { return &audioReader{conn: c} }
+
+func (r *audioReader) Read(p []byte) (int, error) {
+    for len(r.buf) == 0 {
+        if r.err != nil { return 0, r.err }
+        ev, ok := <-r.conn.events
+        if !ok {
+            r.err = r.conn.failure()
+            if r.err == nil { r.err = io.ErrUnexpectedEOF }
+            continue
+        }
+        switch e := ev.(type) {
+        case AudioEvent:
+            r.buf = e.Data
+        case ErrorEvent:
+            r.err = e.Err
+        case FinishedEvent:
+            if r.err == nil { r.err = io.EOF }
+        }
+    }
+    n := copy(p, r.buf)
+    r.buf = r.buf[n:]
+    return n, nil
+}
+
+func (r *audioReader) Close() error {
+    r.conn.Release()
+    return nil
+}
@@ -0,0 +1,94 @@
+package fishaudio
+
+import (
+    "errors"
+    "sync"
+    "time"
+    "github.com/gorilla/websocket"
+)
+
+var ErrWriterClosed = errors.New("websocket writer closed")
+
+type writeReq struct {
+    v    interface{}
+    errc chan error
+}
+
+// wsWriter owns every data-frame write on a websocket. gorilla/websocket allows
+// only one concurrent writer, so all callers go through its queues.
+type wsWriter struct {
+    ws      *websocket.Conn
+    timeout time.Duration
+    ctrl    chan writeReq
+    data    chan writeReq
+    quit    chan struct{}
+    exited  chan struct{}
+    once    sync.Once
+}
+
+func newWSWriter(ws *websocket.Conn, timeout time.Duration, buf int) *wsWriter {
+    if buf <= 0 { buf = 16 }
+    w := &wsWriter{ws: ws, timeout: timeout, ctrl: make(chan writeReq, 4), data: make(chan writeReq, buf), quit: make(chan struct{}), exited: make(chan struct{})}
+    go w.run()
+    return w
+}
+
+func (w *wsWriter) run() {
+    defer close(w.exited)
+    for {
+        var r writeReq
+        // control frames always go before queued text
+        select {
+        case r = <-w.ctrl:
+        default:
+            select {
+            case r = <-w.ctrl:
+            case r = <-w.data:
+            case <-w.quit:
+                return
+            }
+        }
+        r.errc <- w.write(r.v)
+    }
+}
+
+func (w *wsWriter) write(v interface{}) error {
+    select {
+    case <-w.quit:
+        return ErrWriterClosed
+    default:
+    }
+    if w.timeout > 0 { _ = w.ws.SetWriteDeadline(time.Now().Add(w.timeout)) }
+    return writeEvent(w.ws, v)
+}
+
+func (w *wsWriter) Write(v interface{}) error { return w.submit(w.data, v) }
+
+func (w *wsWriter) WriteControl(v interface{}) error { return w.submit(w.ctrl, v) }
+
+func (w *wsWriter) submit(q chan writeReq, v interface{}) error {
+    r := writeReq{v: v, errc: make(chan error, 1)}
+    select {
+    case q <- r:
+    case <-w.quit:
+        return ErrWriterClosed
+    }
+    select {
+    case err := <-r.errc:
+        return err
+    case <-w.quit:
+        select {
+        case err := <-r.errc:
+            return err
+        default:
+            return ErrWriterClosed
+        }
+    }
+}
+
+// Close stops the writer and waits for an in-flight write to finish, so the
+// socket can be handed to another session.
+func (w *wsWriter) Close() {
+    w.once.Do(func() { close(w.quit) })
+    <-w.exited
+}
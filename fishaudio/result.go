@@ -0,0 +1,80 @@
+package fishaudio
+
+import (
+    "context"
+    "strings"
+    "time"
+)
+
+// Result summarizes a finished realtime session. Duration is computed from
+// the audio for the requested format: exactly for pcm, wav and opus, and from
+// the bitrate for mp3. Utterances counts the flushed texts the server
+// answered, one per text even when several were flushed back-to-back; for mp3
+// and pcm a text counts once any audio arrived after its flush. It is zero
+// when the server finished with an error.
+type Result struct {
+    Reason     string
+    Message    string
+    Bytes      int64
+    Duration   time.Duration
+    Utterances int
+}
+
+// ServerError is a session the server finished with reason "error".
+type ServerError struct{ Message string }
+
+func (e *ServerError) Error() string { return e.Message }
+
+// Wait blocks until the session has ended and returns its Result, with the
+// session error if it did not finish normally. Events must still be consumed
+// for the session to make progress.
+func (c *RealtimeConnection) Wait(ctx context.Context) (Result, error) {
+    select {
+    case <-c.done:
+    case <-ctx.Done():
+        return Result{}, ctx.Err()
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.result, c.endErr
+}
+
+// audioDuration returns how long bytes of audio (samples of which were
+// counted) last in the format of req.
+func audioDuration(req TTSRequest, bytes, samples int64) time.Duration {
+    f := "mp3"
+    if req.Format != nil { f = strings.ToLower(*req.Format) }
+    switch f {
+    case "pcm", "wav":
+        rate := 44100
+        if req.SampleRate != nil && *req.SampleRate > 0 { rate = *req.SampleRate }
+        return time.Duration(samples) * time.Second / time.Duration(rate)
+    case "opus":
+        return time.Duration(samples) * time.Second / 48000
+    default:
+        kbps := 128
+        if req.Mp3Bitrate != nil && *req.Mp3Bitrate > 0 { kbps = *req.Mp3Bitrate }
+        return time.Duration(bytes*8) * time.Millisecond / time.Duration(kbps)
+    }
+}
+
+// segmentDuration is the duration of the audio received since the request was
+// last changed; the caller holds c.mu.
+func (c *RealtimeConnection) segmentDuration() time.Duration {
+    return audioDuration(c.req, c.audio-c.segByte, c.samples.samples-c.segSample)
+}
+
+// conclude records how the session ended and sends the final events.
+func (c *RealtimeConnection) conclude(reason, msg string, err error) {
+    c.mu.Lock()
+    var evs []Event
+    for _, u := range c.pending { if !u.flushed.IsZero() { evs = append(evs, c.unconfirm(u)) } }
+    c.pending = nil
+    c.result = Result{Reason: reason, Message: msg, Bytes: c.audio, Duration: c.played + c.segmentDuration(), Utterances: c.completedN}
+    c.endErr = err
+    c.mu.Unlock()
+    for _, ev := range evs { c.emit(ev) }
+    c.emitStats()
+    if err != nil { c.emitFinal(ErrorEvent{Err: err}) }
+    if reason != "" { c.emitFinal(FinishedEvent{Reason: reason, Message: msg}) }
+}
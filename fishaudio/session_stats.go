@@ -0,0 +1,69 @@
+package fishaudio
+
+import "time"
+
+// SessionStats are the timings of one realtime session. Acquire is the time
+// spent getting the first socket, of which Dial was spent dialing; Dial is
+// zero when an idle pooled socket was reused. TimeToFirstAudio is measured
+// from sending start, and each flush latency from its flush to the first
+// audio chunk attributed to it.
+type SessionStats struct {
+    Acquire          time.Duration
+    Dial             time.Duration
+    Reused           bool
+    TimeToFirstAudio time.Duration
+    Flushes          []FlushLatency
+    MaxChunkGap      time.Duration
+    MeanChunkGap     time.Duration
+    Bytes            int64
+    Chunks           int
+    Reconnects       int
+}
+
+// FlushLatency is the time from flushing an utterance to its first audio.
+type FlushLatency struct {
+    Utterance  UtteranceID
+    FirstAudio time.Duration
+}
+
+// StatsEvent carries the final SessionStats. It is sent just before the
+// FinishedEvent or ErrorEvent that ends the session.
+type StatsEvent struct{ Stats SessionStats }
+
+func (StatsEvent) realtimeEvent() {}
+
+type statsRecorder struct {
+    st        SessionStats
+    started   time.Time
+    lastChunk time.Time
+    gaps      time.Duration
+}
+
+func (r *statsRecorder) chunk(n int, now time.Time) {
+    if r.st.Chunks == 0 {
+        if !r.started.IsZero() { r.st.TimeToFirstAudio = now.Sub(r.started) }
+    } else {
+        g := now.Sub(r.lastChunk)
+        r.gaps += g
+        if g > r.st.MaxChunkGap { r.st.MaxChunkGap = g }
+    }
+    r.st.Chunks++
+    r.st.Bytes += int64(n)
+    r.lastChunk = now
+}
+
+func (r *statsRecorder) snapshot() SessionStats {
+    st := r.st
+    st.Flushes = append([]FlushLatency(nil), r.st.Flushes...)
+    if st.Chunks > 1 { st.MeanChunkGap = r.gaps / time.Duration(st.Chunks-1) }
+    return st
+}
+
+// Stats returns the session's timings so far.
+func (c *RealtimeConnection) Stats() SessionStats {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.stats.snapshot()
+}
+
+func (c *RealtimeConnection) emitStats() { c.emitFinal(StatsEvent{Stats: c.Stats()}) }
@@ -0,0 +1,61 @@
+package fishaudio
+
+import (
+    "bytes"
+    "context"
+    "time"
+)
+
+// Stats summarizes the latency of one Speak call.
+type Stats struct {
+    Connect    time.Duration
+    FirstAudio time.Duration
+    Total      time.Duration
+    Bytes      int
+    Chunks     int
+    Reused     bool
+}
+
+// Speak synthesizes req.Text over a pooled realtime socket and blocks until the
+// server finishes, returning the whole audio. Connect covers acquiring the
+// socket and sending start; FirstAudio is measured from there.
+func (c *Client) Speak(ctx context.Context, req TTSRequest, backend string) ([]byte, Stats, error) {
+    var st Stats
+    t0 := time.Now()
+    text := req.Text
+    req.Text = ""
+    conn, err := c.ConvertRealtime(ctx, req, nil, backend)
+    if err != nil { return nil, st, err }
+    st.Connect = time.Since(t0)
+    st.Reused = conn.Stats().Reused
+    t1 := time.Now()
+    if _, err := conn.Send(text); err != nil {
+        conn.ForceClose()
+        return nil, st, err
+    }
+    if err := conn.End(); err != nil {
+        conn.ForceClose()
+        return nil, st, err
+    }
+    var buf bytes.Buffer
+    var serr error
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case AudioEvent:
+            if st.Chunks == 0 { st.FirstAudio = time.Since(t1) }
+            st.Chunks++
+            buf.Write(e.Data)
+        case ErrorEvent:
+            if serr == nil { serr = e.Err }
+        }
+    }
+    st.Total = time.Since(t0)
+    st.Bytes = buf.Len()
+    if serr == nil { serr = conn.failure() }
+    if serr != nil {
+        conn.ForceClose()
+        return nil, st, serr
+    }
+    conn.Release()
+    return buf.Bytes(), st, nil
+}
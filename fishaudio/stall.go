@@ -0,0 +1,55 @@
+package fishaudio
+
+import (
+    "fmt"
+    "time"
+)
+
+// StallError reports a flushed text that got no audio for StallTimeout, either
+// before its first chunk or, with more texts waiting, in the middle of its
+// audio.
+type StallError struct {
+    Utterance UtteranceID
+    Waited    time.Duration
+    MidStream bool
+}
+
+func (e *StallError) Error() string {
+    if e.MidStream { return fmt.Sprintf("utterance %d stalled mid-stream for %s", e.Utterance, e.Waited) }
+    return fmt.Sprintf("utterance %d got no audio for %s after flush", e.Utterance, e.Waited)
+}
+
+// StallEvent is sent when a stall is detected and the session redials instead
+// of failing, see Options.StallRedial.
+type StallEvent struct{ Err *StallError }
+
+func (StallEvent) realtimeEvent() {}
+
+// checkStall looks at the oldest flushed utterance. Quiet after the last text's
+// audio cannot be told apart from its end, so a started utterance only counts
+// as stalled when more texts are waiting behind it.
+func (c *RealtimeConnection) checkStall(now time.Time) *StallError {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    timeout := c.client.Options.StallTimeout
+    if timeout <= 0 || c.interrupting || c.reconfig != nil || len(c.pending) == 0 { return nil }
+    u := c.pending[0]
+    if u.flushed.IsZero() { return nil }
+    ref, mid := u.flushed, false
+    if u.bytes > 0 {
+        if len(c.pending) < 2 { return nil }
+        ref, mid = u.lastAudio, true
+    } else if c.stats.lastChunk.After(ref) {
+        ref = c.stats.lastChunk
+    }
+    if d := now.Sub(ref); d >= timeout { return &StallError{Utterance: u.id, Waited: d, MidStream: mid} }
+    return nil
+}
+
+func stallTicker(timeout time.Duration) (*time.Ticker, <-chan time.Time) {
+    if timeout <= 0 { return nil, nil }
+    d := timeout / 4
+    if d < 5*time.Millisecond { d = 5 * time.Millisecond }
+    t := time.NewTicker(d)
+    return t, t.C
+}
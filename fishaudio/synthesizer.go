@@ -0,0 +1,94 @@
+package fishaudio
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "strings"
+    "unicode/utf8"
+)
+
+type Transport string
+
+const (
+    TransportWebSocket Transport = "websocket"
+    TransportHTTP      Transport = "http"
+)
+
+// SynthResult tells which path served a Synthesize call. When the websocket
+// failed before any audio arrived, Fallback is set and WSErr holds the cause.
+type SynthResult struct {
+    Transport Transport
+    Fallback  bool
+    WSErr     error
+    Status    int
+}
+
+// Synthesizer picks between a pooled realtime websocket and HTTP Convert for
+// each request. Short texts go over the websocket when the request asks for
+// balanced latency or a warm socket for its key is idle; everything else uses
+// HTTP. Texts longer than MaxWSChars always use HTTP.
+type Synthesizer struct {
+    Client     *Client
+    MaxWSChars int
+}
+
+func NewSynthesizer(c *Client) *Synthesizer { return &Synthesizer{Client: c, MaxWSChars: 500} }
+
+func (s *Synthesizer) Synthesize(ctx context.Context, req TTSRequest, backend string) (io.ReadCloser, SynthResult, error) {
+    if !s.useWebSocket(req, backend) { return s.http(ctx, req, backend, SynthResult{}) }
+    body, err := s.websocket(ctx, req, backend)
+    if err == nil { return body, SynthResult{Transport: TransportWebSocket}, nil }
+    if ctx.Err() != nil { return nil, SynthResult{Transport: TransportWebSocket}, err }
+    return s.http(ctx, req, backend, SynthResult{Fallback: true, WSErr: err})
+}
+
+func (s *Synthesizer) useWebSocket(req TTSRequest, backend string) bool {
+    limit := s.MaxWSChars
+    if limit <= 0 { limit = 500 }
+    if utf8.RuneCountInString(req.Text) > limit { return false }
+    if req.Latency != nil && strings.ToLower(*req.Latency) == "balanced" { return true }
+    c := s.Client
+    return c.Options.DefaultPooling && c.Pool != nil && c.Pool.IdleCount(poolKey(c.BaseURL, backend, req)) > 0
+}
+
+// websocket runs the request over a realtime session and waits for the first
+// audio, so that failures before any audio can still fall back to HTTP.
+func (s *Synthesizer) websocket(ctx context.Context, req TTSRequest, backend string) (io.ReadCloser, error) {
+    text := req.Text
+    req.Text = ""
+    conn, err := s.Client.ConvertRealtime(ctx, req, nil, backend)
+    if err != nil { return nil, err }
+    if _, err := conn.Send(text); err != nil {
+        conn.ForceClose()
+        return nil, err
+    }
+    if err := conn.End(); err != nil {
+        conn.ForceClose()
+        return nil, err
+    }
+    r := conn.AudioReader()
+    buf := make([]byte, 32<<10)
+    n, err := r.Read(buf)
+    if n == 0 {
+        _ = r.Close()
+        if err == nil || err == io.EOF { err = io.ErrUnexpectedEOF }
+        return nil, err
+    }
+    return struct {
+        io.Reader
+        io.Closer
+    }{io.MultiReader(bytes.NewReader(buf[:n]), r), r}, nil
+}
+
+func (s *Synthesizer) http(ctx context.Context, req TTSRequest, backend string, res SynthResult) (io.ReadCloser, SynthResult, error) {
+    res.Transport = TransportHTTP
+    body, status, err := s.Client.Convert(ctx, req, backend)
+    res.Status = status
+    if err != nil {
+        if status != 0 { err = fmt.Errorf("tts http status %d", status) }
+        return nil, res, err
+    }
+    return body, res, nil
+}
@@ -0,0 +1,113 @@
+package fishaudio
+
+import (
+    "bytes"
+    "strings"
+    "time"
+)
+
+// UtteranceID identifies one flushed text within a realtime session.
+type UtteranceID uint64
+
+// utterance is a text that was handed to the server but has not yet received
+// its complete audio response.
+type utterance struct {
+    id          UtteranceID
+    stop        bool
+    text        string
+    flushed     time.Time
+    lastAudio   time.Time
+    bytes       int
+    replayed    bool
+    started     bool
+    timed       bool
+    inferred    bool
+    startByte   int64
+    startSample int64
+    endByte     int64
+    endSample   int64
+    discarded   int64
+}
+
+func (u *utterance) completed() UtteranceCompletedEvent {
+    return UtteranceCompletedEvent{ID: u.id, ByteOffset: u.startByte, ByteEnd: u.endByte, SampleOffset: u.startSample, SampleEnd: u.endSample, Discarded: u.discarded, Inferred: u.inferred}
+}
+
+// segmented reports whether the server's answer to each flush starts with its
+// own header in format, so that utterance boundaries can be read from the
+// stream: a RIFF header for wav, a new Ogg stream for opus.
+func segmented(format string) bool { return format == "wav" || format == "opus" }
+
+// segmentStart reports whether chunk begins the answer to a new flush.
+func segmentStart(format string, chunk []byte) bool {
+    switch format {
+    case "wav":
+        return bytes.HasPrefix(chunk, []byte("RIFF"))
+    case "opus":
+        // an Ogg page with the beginning-of-stream flag
+        return len(chunk) > 5 && bytes.HasPrefix(chunk, oggSig) && chunk[5]&0x02 != 0
+    }
+    return false
+}
+
+// sampleCounter counts decoded samples of the audio stream for the formats
+// where that is possible without decoding: pcm, wav and opus.
+type sampleCounter struct {
+    format  string
+    samples int64
+    odd     bool
+}
+
+func newSampleCounter(req TTSRequest) *sampleCounter {
+    f := "mp3"
+    if req.Format != nil { f = strings.ToLower(*req.Format) }
+    return &sampleCounter{format: f}
+}
+
+func (s *sampleCounter) add(chunk []byte, packets [][]byte) {
+    switch s.format {
+    case "wav":
+        if bytes.HasPrefix(chunk, []byte("RIFF")) {
+            if i := bytes.Index(chunk, []byte("data")); i >= 0 && len(chunk) >= i+8 { chunk = chunk[i+8:] }
+        }
+        s.addPCM(chunk)
+    case "pcm":
+        s.addPCM(chunk)
+    case "opus":
+        for _, p := range packets { s.samples += opusPacketSamples(p) }
+    }
+}
+
+// addPCM counts 16-bit mono samples, carrying a split sample to the next chunk.
+func (s *sampleCounter) addPCM(b []byte) {
+    n := len(b)
+    if s.odd { n++ }
+    s.samples += int64(n / 2)
+    s.odd = n%2 == 1
+}
+
+// opusPacketSamples returns the duration of an opus packet in 48kHz samples,
+// read from its TOC byte. Header packets count as zero.
+func opusPacketSamples(p []byte) int64 {
+    if len(p) == 0 || bytes.HasPrefix(p, []byte("OpusHead")) || bytes.HasPrefix(p, []byte("OpusTags")) { return 0 }
+    toc := p[0]
+    cfg := int(toc >> 3)
+    var frame int64
+    switch {
+    case cfg < 12:
+        frame = []int64{480, 960, 1920, 2880}[cfg%4]
+    case cfg < 16:
+        frame = []int64{480, 960}[cfg%2]
+    default:
+        frame = []int64{120, 240, 480, 960}[cfg%4]
+    }
+    switch toc & 3 {
+    case 0:
+        return frame
+    case 1, 2:
+        return 2 * frame
+    default:
+        if len(p) < 2 { return 0 }
+        return int64(p[1]&0x3f) * frame
+    }
+}
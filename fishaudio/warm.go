@@ -0,0 +1,17 @@
+package fishaudio
+
+import "context"
+
+// WarmRealtime dials n pooled realtime sockets for the key of req and backend
+// ahead of the first ConvertRealtime.
+func (c *Client) WarmRealtime(ctx context.Context, req TTSRequest, backend string, n int) error {
+    if c.Pool == nil { return nil }
+    return c.Pool.Warm(ctx, poolKey(c.BaseURL, backend, req), n, c.liveDialer(ctx, backend, defaultHandshakeTimeout))
+}
+
+// KeepWarm makes the pool keep n idle realtime sockets for the key of req and
+// backend, redialing as connections expire.
+func (c *Client) KeepWarm(req TTSRequest, backend string, n int) {
+    if c.Pool == nil { return }
+    c.Pool.SetMinIdle(poolKey(c.BaseURL, backend, req), n, c.liveDialer(context.Background(), backend, defaultHandshakeTimeout))
+}
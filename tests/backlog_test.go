@@ -0,0 +1,165 @@
+package tests
+
+import (
+    "context"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+// heldSession returns a session that is interrupting, so texts stay queued
+// until the fake server answers the stop.
+func heldSession(t *testing.T, policy fa.OverflowPolicy) (*fa.RealtimeConnection, context.Context) {
+    f := newFakeTTS(t)
+    f.stopDelay = 300 * time.Millisecond
+    c := f.client(t)
+    c.Options.SendQueueLimit = 2
+    c.Options.SendOverflow = policy
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    t.Cleanup(cancel)
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    t.Cleanup(conn.ForceClose)
+    if err := conn.Interrupt(); err != nil { t.Fatal(err) }
+    return conn, ctx
+}
+
+func TestSendOverflowError(t *testing.T) {
+    conn, _ := heldSession(t, fa.OverflowError)
+    drain(conn)
+    conn.Send("a")
+    conn.Send("b")
+    if _, err := conn.Send("c"); err != fa.ErrQueueFull { t.Fatalf("send: %v", err) }
+    if n := conn.TextCounts(); n.Queued != 2 { t.Fatalf("counts %+v", n) }
+}
+
+func TestSendOverflowDropOldest(t *testing.T) {
+    conn, _ := heldSession(t, fa.OverflowDropOldest)
+    a, _ := conn.Send("a")
+    conn.Send("b")
+    if _, err := conn.Send("c"); err != nil { t.Fatal(err) }
+    for ev := range conn.Events() {
+        if e, ok := ev.(fa.UtteranceDroppedEvent); ok {
+            if e.ID != a || e.Text != "a" { t.Fatalf("dropped %+v", e) }
+            if n := conn.TextCounts(); n.Dropped != 1 || n.Queued != 3 { t.Fatalf("counts %+v", n) }
+            return
+        }
+    }
+    t.Fatalf("no drop event")
+}
+
+func TestSendOverflowBlock(t *testing.T) {
+    conn, _ := heldSession(t, fa.OverflowBlock)
+    drain(conn)
+    conn.Send("a")
+    conn.Send("b")
+    t0 := time.Now()
+    if _, err := conn.Send("c"); err != nil { t.Fatal(err) }
+    if d := time.Since(t0); d < 100*time.Millisecond { t.Fatalf("send did not block (%s)", d) }
+}
+
+func TestTextCounts(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    conn.Send("héllo")
+    conn.End()
+    if _, err := conn.Wait(ctx); err != nil { t.Fatal(err) }
+    want := fa.TextCounts{Queued: 5, Sent: 5, Flushed: 5, Confirmed: 5}
+    if n := conn.TextCounts(); n != want { t.Fatalf("counts %+v", n) }
+    conn.Release()
+}
+
+func TestTextCountsBackToBack(t *testing.T) {
+    for _, format := range []string{"mp3", "wav"} {
+        t.Run(format, func(t *testing.T) {
+            f := newFakeTTS(t)
+            f.perFlush = 2
+            c := f.client(t)
+            ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+            defer cancel()
+            format := format
+            conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{Format: &format}, nil, "s1")
+            if err != nil { t.Fatal(err) }
+            drain(conn)
+            conn.Send("one")
+            conn.Send("two")
+            conn.Send("three")
+            conn.End()
+            if _, err := conn.Wait(ctx); err != nil { t.Fatal(err) }
+            want := fa.TextCounts{Queued: 11, Sent: 11, Flushed: 11, Confirmed: 11}
+            if n := conn.TextCounts(); n != want { t.Fatalf("counts %+v", n) }
+            conn.Release()
+        })
+    }
+}
+
+func TestTextCountsUnconfirmed(t *testing.T) {
+    f := newFakeTTS(t)
+    f.silentFlush = 2
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    // wav marks each answer, so the silent flush is known to be unanswered
+    format := "wav"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{Format: &format}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    one, _ := conn.Send("one")
+    two, _ := conn.Send("silent")
+    conn.End()
+    var unconfirmed []fa.UtteranceID
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.UtteranceUnconfirmedEvent:
+            if e.Text != "silent" { t.Fatalf("unconfirmed %+v", e) }
+            unconfirmed = append(unconfirmed, e.ID)
+        case fa.UtteranceCompletedEvent:
+            if e.ID != one { t.Fatalf("completed %d without audio", e.ID) }
+        }
+    }
+    if len(unconfirmed) != 1 || unconfirmed[0] != two { t.Fatalf("unconfirmed %v", unconfirmed) }
+    want := fa.TextCounts{Queued: 9, Sent: 9, Flushed: 9, Confirmed: 3, Unconfirmed: 6}
+    if n := conn.TextCounts(); n != want { t.Fatalf("counts %+v", n) }
+    conn.Release()
+}
+
+func TestTextsChannelQueueFull(t *testing.T) {
+    f := newFakeTTS(t)
+    f.stopDelay = 300 * time.Millisecond
+    c := f.client(t)
+    c.Options.SendQueueLimit = 2
+    c.Options.SendOverflow = fa.OverflowError
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string)
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatal(err) }
+    defer conn.Release()
+    if err := conn.Interrupt(); err != nil { t.Fatal(err) }
+    for _, s := range []string{"a", "b", "c", "d"} {
+        select {
+        case texts <- s:
+        case <-ctx.Done():
+            t.Fatalf("texts channel not drained at %q", s)
+        }
+    }
+    close(texts)
+    var dropped []string
+    finished := false
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.UtteranceDroppedEvent:
+            if e.ID != 0 { t.Fatalf("dropped %+v", e) }
+            dropped = append(dropped, e.Text)
+        case fa.FinishedEvent:
+            finished = true
+        }
+    }
+    if len(dropped) != 2 || dropped[0] != "c" || dropped[1] != "d" { t.Fatalf("dropped %q", dropped) }
+    if !finished { t.Fatalf("session did not end after the channel closed") }
+    if got := f.textEvents(); len(got) != 2 || got[0] != "a" || got[1] != "b" { t.Fatalf("server texts %q", got) }
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func coalesced(t *testing.T, f *fakeTTS, c *fa.Client, parts []string) []string {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string)
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    for _, p := range parts { texts <- p }
+    close(texts)
+    if _, err := conn.Wait(ctx); err != nil { t.Fatal(err) }
+    conn.Release()
+    return f.textEvents()
+}
+
+func TestCoalesceBurst(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    c.Options.CoalesceDelay = 200 * time.Millisecond
+    parts := []string{"Hel", "lo ", "wor", "ld, ", "how ", "are ", "you?"}
+    got := coalesced(t, f, c, parts)
+    if strings.Join(got, "") != strings.Join(parts, "") || len(got) >= len(parts) { t.Fatalf("texts %q", got) }
+}
+
+func TestCoalesceMaxSizeKeepsWords(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    c.Options.CoalesceDelay = time.Second
+    c.Options.CoalesceMaxChars = 12
+    parts := []string{"the quick ", "brown fox ", "jumps over ", "the lazy dog"}
+    got := coalesced(t, f, c, parts)
+    if strings.Join(got, "") != strings.Join(parts, "") { t.Fatalf("texts %q", got) }
+    for _, s := range got[:len(got)-1] {
+        if len([]rune(s)) > 12 || !strings.HasSuffix(s, " ") { t.Fatalf("bad cut %q in %q", s, got) }
+    }
+}
+
+func TestCoalesceCJK(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    c.Options.CoalesceDelay = time.Second
+    c.Options.CoalesceMaxChars = 4
+    got := coalesced(t, f, c, []string{"你好世界", "再见"})
+    if strings.Join(got, "") != "你好世界再见" || got[0] != "你好世界" { t.Fatalf("texts %q", got) }
+}
+
+func TestCoalesceAfterMaxSizeCut(t *testing.T) {
+    f := newFakeTTS(t)
+    f.stopDelay = 600 * time.Millisecond
+    c := f.client(t)
+    c.Options.CoalesceDelay = 100 * time.Millisecond
+    c.Options.CoalesceMaxChars = 8
+    c.Options.SendQueueLimit = 1
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string)
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    // the interrupt holds the queue, so the cut below waits to be handed
+    // on while its timer fires
+    if err := conn.Interrupt(); err != nil { t.Fatal(err) }
+    texts <- "first "
+    time.Sleep(150 * time.Millisecond)
+    texts <- "second "
+    time.Sleep(150 * time.Millisecond)
+    texts <- "ab"
+    texts <- "cdefgh"
+    texts <- "x "
+    time.Sleep(30 * time.Millisecond)
+    texts <- "y"
+    close(texts)
+    if _, err := conn.Wait(ctx); err != nil { t.Fatal(err) }
+    conn.Release()
+    got := f.textEvents()
+    if len(got) == 0 || got[len(got)-1] != "x y" { t.Fatalf("texts %q", got) }
+}
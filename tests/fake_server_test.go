@@ -0,0 +1,153 @@
+package tests
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+    "github.com/gorilla/websocket"
+    "github.com/vmihailenco/msgpack/v5"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+// fakeTTS serves POST /v1/tts with httpAudio and the live endpoint on every
+// other path. failStart drops live connections as soon as start arrives.
+// On the live endpoint it answers every flush with one audio frame and every stop with finish.
+// Frames in onStart are sent right after the start event; finishAfter > 0 ends
+// the session by itself after that many flushes. perFlush sets how many audio
+// frames each flush produces. dropOnFlush > 0 kills the
+// first connection without a close frame when that flush arrives.
+// silentFlush > 0 makes the first connection ignore that flush. stopDelay
+// holds back the finish that answers stop. dropAfterFrames > 0 kills the first
+// connection without a close frame once it has sent that many audio frames.
+// redialDelay holds back the handshake of every connection after the first;
+// closed counts live connections that have ended.
+// When start asks for wav, the first frame of every flush begins with RIFF, as
+// the live endpoint starts each answer with a header.
+type fakeTTS struct {
+    conns           int32
+    httpCalls       int32
+    httpAudio       []byte
+    failStart       bool
+    dropOnFlush     int
+    silentFlush     int
+    stopDelay       time.Duration
+    dropAfterFrames int
+    redialDelay     time.Duration
+    closed          int32
+    srv             *httptest.Server
+    audio           []byte
+    onStart         []map[string]interface{}
+    perFlush        int
+    finishAfter     int
+    finishReason    string
+    mu              sync.Mutex
+    starts          []map[string]interface{}
+    texts           []string
+}
+
+func newFakeTTS(t *testing.T) *fakeTTS {
+    f := &fakeTTS{audio: make([]byte, 320), httpAudio: []byte("http-audio")}
+    up := websocket.Upgrader{}
+    f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path == "/v1/tts" {
+            atomic.AddInt32(&f.httpCalls, 1)
+            _, _ = w.Write(f.httpAudio)
+            return
+        }
+        if atomic.LoadInt32(&f.conns) > 0 { time.Sleep(f.redialDelay) }
+        c, err := up.Upgrade(w, r, nil)
+        if err != nil { return }
+        defer atomic.AddInt32(&f.closed, 1)
+        defer c.Close()
+        n := atomic.AddInt32(&f.conns, 1)
+        finish := func(reason string) error {
+            m := map[string]interface{}{"event": "finish", "reason": reason}
+            if reason == "error" { m["message"] = "synthesis failed" }
+            b, _ := msgpack.Marshal(m)
+            return c.WriteMessage(websocket.BinaryMessage, b)
+        }
+        flushes, frames, wav := 0, 0, false
+        for {
+            _, data, err := c.ReadMessage()
+            if err != nil { return }
+            var ev map[string]interface{}
+            if err := msgpack.Unmarshal(data, &ev); err != nil { return }
+            switch ev["event"] {
+            case "start":
+                if f.failStart { return }
+                if req, ok := ev["request"].(map[string]interface{}); ok {
+                    wav = req["format"] == "wav"
+                    f.mu.Lock()
+                    f.starts = append(f.starts, req)
+                    f.mu.Unlock()
+                }
+                for _, m := range f.onStart {
+                    b, _ := msgpack.Marshal(m)
+                    if err := c.WriteMessage(websocket.BinaryMessage, b); err != nil { return }
+                }
+            case "text":
+                f.mu.Lock()
+                f.texts = append(f.texts, ev["text"].(string))
+                f.mu.Unlock()
+            case "flush":
+                if n == 1 && f.dropOnFlush > 0 && flushes+1 == f.dropOnFlush {
+                    _ = c.UnderlyingConn().Close()
+                    return
+                }
+                if n == 1 && f.silentFlush > 0 && flushes+1 == f.silentFlush {
+                    flushes++
+                    continue
+                }
+                b, _ := msgpack.Marshal(map[string]interface{}{"event": "audio", "audio": f.audio})
+                head := b
+                if wav {
+                    a := append([]byte("RIFF"), f.audio[4:]...)
+                    head, _ = msgpack.Marshal(map[string]interface{}{"event": "audio", "audio": a})
+                }
+                for i := 0; i < f.perFlush || i == 0; i++ {
+                    if n == 1 && f.dropAfterFrames > 0 && frames == f.dropAfterFrames {
+                        _ = c.UnderlyingConn().Close()
+                        return
+                    }
+                    m := b
+                    if i == 0 { m = head }
+                    if err := c.WriteMessage(websocket.BinaryMessage, m); err != nil { return }
+                    frames++
+                }
+                flushes++
+                if f.finishAfter > 0 && flushes == f.finishAfter {
+                    reason := f.finishReason
+                    if reason == "" { reason = "stop" }
+                    if err := finish(reason); err != nil { return }
+                }
+            case "stop":
+                time.Sleep(f.stopDelay)
+                if err := finish("stop"); err != nil { return }
+            }
+        }
+    }))
+    t.Cleanup(f.srv.Close)
+    return f
+}
+
+func (f *fakeTTS) startRequests() []map[string]interface{} {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([]map[string]interface{}(nil), f.starts...)
+}
+
+func (f *fakeTTS) textEvents() []string {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([]string(nil), f.texts...)
+}
+
+func (f *fakeTTS) client(t *testing.T) *fa.Client {
+    c, err := fa.NewClient("test-key")
+    if err != nil { t.Fatalf("client: %v", err) }
+    c.BaseURL = f.srv.URL
+    return c
+}
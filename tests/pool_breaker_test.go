@@ -0,0 +1,60 @@
+package tests
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "sync/atomic"
+    "testing"
+    "time"
+    "github.com/gorilla/websocket"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestPoolCircuitBreaker(t *testing.T) {
+    d := newWSDialer(t)
+    var down int32 = 1
+    var calls int32
+    dial := func() (*websocket.Conn, *http.Response, error) {
+        atomic.AddInt32(&calls, 1)
+        if atomic.LoadInt32(&down) == 1 { return nil, nil, errors.New("connection refused") }
+        return d.dial()
+    }
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{BreakerThreshold: 2, BreakerOpen: 50 * time.Millisecond, BreakerMaxOpen: time.Second})
+    ctx := context.Background()
+    acquire := func() error {
+        _, rel, _, err := p.Acquire(ctx, "k", dial)
+        if err == nil { rel() }
+        return err
+    }
+    for i := 0; i < 2; i++ {
+        if err := acquire(); err == nil || err == fa.ErrCircuitOpen { t.Fatalf("dial %d: %v", i, err) }
+    }
+    if err := acquire(); err != fa.ErrCircuitOpen { t.Fatalf("breaker not open: %v", err) }
+    if n := atomic.LoadInt32(&calls); n != 2 { t.Fatalf("dialed %d times while open", n) }
+    if st := p.Stats()["k"]; st.Breaker != "open" { t.Fatalf("state %q", st.Breaker) }
+
+    // the half-open probe fails, so the breaker stays open twice as long
+    time.Sleep(60 * time.Millisecond)
+    if err := acquire(); err == nil || err == fa.ErrCircuitOpen { t.Fatalf("probe: %v", err) }
+    time.Sleep(60 * time.Millisecond)
+    if err := acquire(); err != fa.ErrCircuitOpen { t.Fatalf("breaker not reopened with backoff: %v", err) }
+
+    atomic.StoreInt32(&down, 0)
+    time.Sleep(60 * time.Millisecond)
+    if err := acquire(); err != nil { t.Fatalf("probe after recovery: %v", err) }
+    if st := p.Stats()["k"]; st.Breaker != "closed" { t.Fatalf("state %q", st.Breaker) }
+    if n := atomic.LoadInt32(&calls); n != 4 { t.Fatalf("dialed %d times", n) }
+}
+
+func TestPoolBreakerMaxOpenDefault(t *testing.T) {
+    for _, tc := range []struct{ open, max, want time.Duration }{
+        {0, 0, 30 * time.Second},
+        {10 * time.Second, 0, 30 * time.Second},
+        {45 * time.Second, 0, 45 * time.Second},
+        {time.Second, 5 * time.Second, 5 * time.Second},
+    } {
+        p := fa.NewWSConnPoolConfig(fa.PoolConfig{BreakerThreshold: 1, BreakerOpen: tc.open, BreakerMaxOpen: tc.max})
+        if got := p.Config(); got.BreakerMaxOpen != tc.want || got.BreakerMaxOpen < got.BreakerOpen { t.Fatalf("open %s max %s: got %+v", tc.open, tc.max, got) }
+    }
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+    "context"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+    "github.com/Helios-Orbit/H.D.D-audio/fishaudio/fishaudiotest"
+)
+
+func TestPoolReaperFakeClock(t *testing.T) {
+    d := newWSDialer(t)
+    clk := fishaudiotest.NewClock(time.Unix(1700000000, 0))
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 2, IdleTTL: time.Minute, MaxLife: time.Hour, TextIdleTTL: time.Hour, ReapInterval: 10 * time.Second, Clock: clk})
+    ctx := context.Background()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    // the reaper is asleep
+    clk.BlockUntil(1)
+    clk.Advance(50 * time.Second)
+    clk.BlockUntil(1)
+    if st := p.Stats()["k"]; st.Open != 1 || len(st.Evictions) != 0 { t.Fatalf("reaped too early: %+v", st) }
+    clk.Advance(20 * time.Second)
+    clk.BlockUntil(1)
+    if st := p.Stats()["k"]; st.Open != 0 || st.Evictions[fa.EvictIdleTTL] != 1 { t.Fatalf("not reaped: %+v", st) }
+}
+
+func TestPoolExpiredOnAcquireFakeClock(t *testing.T) {
+    d := newWSDialer(t)
+    clk := fishaudiotest.NewClock(time.Unix(1700000000, 0))
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 1, IdleTTL: time.Hour, MaxLife: 10 * time.Minute, TextIdleTTL: time.Hour, ReapInterval: 24 * time.Hour, Clock: clk})
+    ctx := context.Background()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    clk.Advance(9 * time.Minute)
+    if n := p.IdleCount("k"); n != 1 { t.Fatalf("idle %d before max life", n) }
+    clk.Advance(2 * time.Minute)
+    if n := p.IdleCount("k"); n != 0 { t.Fatalf("idle %d after max life", n) }
+    _, rel, _, err = p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    if st := p.Stats()["k"]; st.Dials != 2 || st.Evictions[fa.EvictMaxLife] != 1 { t.Fatalf("stats %+v", st) }
+}
+
+func TestAcquireDeadlineFakeClock(t *testing.T) {
+    d := newWSDialer(t)
+    clk := fishaudiotest.NewClock(time.Unix(1700000000, 0))
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 1, ReapInterval: 24 * time.Hour, Clock: clk})
+    ctx := context.Background()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    defer rel()
+    clk.BlockUntil(1)
+    errc := make(chan error, 1)
+    go func() {
+        _, _, _, err := p.Acquire(ctx, "k", d.dial, fa.AcquireDeadline(clk.Now().Add(time.Minute)))
+        errc <- err
+    }()
+    clk.BlockUntil(2)
+    clk.Advance(30 * time.Second)
+    select {
+    case err := <-errc:
+        t.Fatalf("gave up early: %v", err)
+    case <-time.After(20 * time.Millisecond):
+    }
+    clk.Advance(31 * time.Second)
+    if err := <-errc; err != fa.ErrAcquireTimeout { t.Fatalf("err %v", err) }
+}
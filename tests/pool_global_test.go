@@ -0,0 +1,77 @@
+package tests
+
+import (
+    "context"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestPoolMaxTotalEvictsLRU(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 2, MaxTotalConns: 2})
+    ctx := context.Background()
+    _, relA, _, err := p.Acquire(ctx, "a", d.dial)
+    if err != nil { t.Fatal(err) }
+    _, relB, _, err := p.Acquire(ctx, "b", d.dial)
+    if err != nil { t.Fatal(err) }
+    relA()
+    time.Sleep(5 * time.Millisecond)
+    relB()
+    _, relC, _, err := p.Acquire(ctx, "c", d.dial)
+    if err != nil { t.Fatal(err) }
+    defer relC()
+    if n := atomic.LoadInt32(&d.dials); n != 3 { t.Fatalf("dialed %d sockets", n) }
+    st := p.Stats()
+    if st["a"].Open != 0 || st["a"].Evictions[fa.EvictLRU] != 1 || st["b"].Idle != 1 { t.Fatalf("stats %+v", st) }
+}
+
+func TestPoolMaxTotalFairWaiting(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 2, MaxTotalConns: 1})
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    _, rel, _, err := p.Acquire(ctx, "a", d.dial)
+    if err != nil { t.Fatal(err) }
+    var mu sync.Mutex
+    var order []string
+    var wg sync.WaitGroup
+    for _, k := range []string{"b", "c", "d"} {
+        wg.Add(1)
+        go func(k string) {
+            defer wg.Done()
+            _, r, _, err := p.Acquire(ctx, k, d.dial)
+            if err != nil { t.Error(err); return }
+            mu.Lock()
+            order = append(order, k)
+            mu.Unlock()
+            time.Sleep(5 * time.Millisecond)
+            r()
+        }(k)
+        time.Sleep(20 * time.Millisecond)
+    }
+    rel()
+    wg.Wait()
+    if len(order) != 3 || order[0] != "b" || order[1] != "c" || order[2] != "d" { t.Fatalf("order %v", order) }
+    open := 0
+    for _, st := range p.Stats() { open += st.Open }
+    if open != 1 { t.Fatalf("%d sockets open for a cap of 1", open) }
+}
+
+func TestPoolMaxTotalCancelledWaiter(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxTotalConns: 1})
+    _, rel, _, err := p.Acquire(context.Background(), "a", d.dial)
+    if err != nil { t.Fatal(err) }
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    if _, _, _, err := p.Acquire(ctx, "b", d.dial); err != context.DeadlineExceeded { t.Fatalf("acquire: %v", err) }
+    rel()
+    ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+    defer cancel2()
+    _, rel, _, err = p.Acquire(ctx2, "b", d.dial)
+    if err != nil { t.Fatalf("slot leaked: %v", err) }
+    rel()
+}
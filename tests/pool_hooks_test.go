@@ -0,0 +1,61 @@
+package tests
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+    "github.com/gorilla/websocket"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestPoolHooks(t *testing.T) {
+    d := newWSDialer(t)
+    var mu sync.Mutex
+    var got []string
+    var p *fa.WSConnPool
+    log := func(f string, a ...interface{}) {
+        _ = p.Stats() // hooks may call back into the pool
+        mu.Lock()
+        got = append(got, fmt.Sprintf(f, a...))
+        mu.Unlock()
+    }
+    p = fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 1, IdleTTL: 30 * time.Millisecond, Hooks: fa.PoolHooks{
+        OnDial: func(key string, d time.Duration, err error) { log("dial %s %v", key, err) },
+        OnAcquire: func(key string, wait time.Duration, reused bool) { log("acquire %s %v", key, reused) },
+        OnRelease: func(key string, held time.Duration, forced bool) { log("release %s %v", key, forced) },
+        OnEvict: func(key string, reason fa.EvictReason) { log("evict %s %s", key, reason) },
+    }})
+    ctx := context.Background()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    _, _, force, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    force()
+    fail := func() (*websocket.Conn, *http.Response, error) { return nil, nil, errors.New("refused") }
+    if _, _, _, err := p.Acquire(ctx, "k", fail); err == nil { t.Fatalf("expected dial failure") }
+    _, rel, _, err = p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    time.Sleep(60 * time.Millisecond)
+    // the idle connection expired; Acquire drops it before dialing
+    _, rel, _, err = p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+
+    want := []string{
+        "dial k <nil>", "acquire k false", "release k false",
+        "acquire k true", "evict k forced", "release k true",
+        "dial k refused",
+        "dial k <nil>", "acquire k false", "release k false",
+        "evict k idleTTL", "dial k <nil>", "acquire k false", "release k false",
+    }
+    mu.Lock()
+    defer mu.Unlock()
+    if !reflect.DeepEqual(got, want) { t.Fatalf("hooks:\n%q\nwant\n%q", got, want) }
+}
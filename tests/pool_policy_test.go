@@ -0,0 +1,34 @@
+package tests
+
+import (
+    "context"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestPoolKeyPolicies(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 1, Policies: []fa.KeyPolicy{
+        {ReferenceID: "fairy", MaxPerKey: 3, MaxLife: 30 * time.Minute},
+        {Backend: "S1", Format: "opus", MaxPerKey: 2},
+    }})
+    ctx := context.Background()
+    keys := map[string]int{
+        "https://api.fish.audio|s1|mp3|fairy": 3,
+        "https://api.fish.audio|s1|mp3|fairy|bulk": 3,
+        "https://api.fish.audio|s1|opus||bulk": 2,
+        "https://api.fish.audio|s1|opus|": 2,
+        "https://api.fish.audio|s1|mp3|other": 1,
+        "custom": 1,
+    }
+    for k, want := range keys {
+        if err := p.Warm(ctx, k, 5, d.dial); err != nil { t.Fatal(err) }
+        if n := p.IdleCount(k); n != want { t.Fatalf("%s: idle %d, want %d", k, n, want) }
+        if st := p.Stats()[k]; st.MaxPerKey != want { t.Fatalf("%s: stats %+v", k, st) }
+    }
+    cfg := p.Config()
+    cfg.Policies = nil
+    p.Update(cfg)
+    if n := p.IdleCount("https://api.fish.audio|s1|mp3|fairy"); n != 1 { t.Fatalf("policy removal not applied: idle %d", n) }
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+    "github.com/gorilla/websocket"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+    "github.com/Helios-Orbit/H.D.D-audio/fishaudio/fishaudiotest"
+)
+
+func TestPoolProbeOnAcquire(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 1, ProbeOnAcquire: true, ProbeTimeout: 200 * time.Millisecond})
+    ctx := context.Background()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    // a live socket answers the ping and is reused
+    _, rel, _, err = p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    if n := atomic.LoadInt32(&d.dials); n != 1 { t.Fatalf("dialed %d sockets", n) }
+    d.dropAll()
+    time.Sleep(20 * time.Millisecond)
+    ws, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    defer rel()
+    if n := atomic.LoadInt32(&d.dials); n != 2 { t.Fatalf("dead socket was handed out, %d dials", n) }
+    if err := ws.WriteMessage(1, []byte("x")); err != nil { t.Fatalf("replacement unusable: %v", err) }
+    if st := p.Stats()["k"]; st.Evictions[fa.EvictDead] != 1 { t.Fatalf("stats %+v", st) }
+}
+
+func TestPoolBackgroundProbe(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 2, ProbeInterval: 20 * time.Millisecond, ProbeTimeout: 200 * time.Millisecond})
+    if err := p.Warm(context.Background(), "k", 2, d.dial); err != nil { t.Fatal(err) }
+    time.Sleep(60 * time.Millisecond)
+    if n := p.IdleCount("k"); n != 2 { t.Fatalf("live sockets dropped: idle %d", n) }
+    d.dropAll()
+    deadline := time.Now().Add(2 * time.Second)
+    for p.IdleCount("k") > 0 && time.Now().Before(deadline) { time.Sleep(10 * time.Millisecond) }
+    if n := p.IdleCount("k"); n != 0 { t.Fatalf("dead sockets kept: idle %d", n) }
+}
+
+func TestPoolProbeHonorsContext(t *testing.T) {
+    // the server never reads, so pings go unanswered
+    stop := make(chan struct{})
+    up := websocket.Upgrader{}
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        c, err := up.Upgrade(w, r, nil)
+        if err != nil { return }
+        defer c.Close()
+        <-stop
+    }))
+    defer srv.Close()
+    defer close(stop)
+    dial := func() (*websocket.Conn, *http.Response, error) { return websocket.DefaultDialer.Dial("ws://"+srv.Listener.Addr().String(), nil) }
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 1, ProbeOnAcquire: true, ProbeTimeout: 10 * time.Second})
+    _, rel, _, err := p.Acquire(context.Background(), "k", dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    t0 := time.Now()
+    if _, _, _, err := p.Acquire(ctx, "k", dial); err != context.DeadlineExceeded { t.Fatalf("acquire: %v", err) }
+    if d := time.Since(t0); d > time.Second { t.Fatalf("probe ignored the context for %s", d) }
+    // an unfinished probe proves nothing; the socket stays pooled
+    if st := p.Stats()["k"]; st.Open != 1 || st.Idle != 1 || st.Evictions[fa.EvictDead] != 0 { t.Fatalf("stats %+v", st) }
+}
+
+func TestPoolProbeLoopOnlyWhenEnabled(t *testing.T) {
+    clk := fishaudiotest.NewClock(time.Unix(1700000000, 0))
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{Clock: clk})
+    clk.BlockUntil(1)
+    time.Sleep(20 * time.Millisecond)
+    if n := clk.Timers(); n != 1 { t.Fatalf("%d timers with probing off, want only the reaper", n) }
+    cfg := p.Config()
+    cfg.ProbeInterval = time.Second
+    p.Update(cfg)
+    clk.BlockUntil(2)
+    cfg.ProbeInterval = 0
+    p.Update(cfg)
+    clk.Advance(time.Second)
+    // the probe loop wakes up, sees probing is off and exits
+    deadline := time.Now().Add(2 * time.Second)
+    for clk.Timers() != 1 && time.Now().Before(deadline) { time.Sleep(5 * time.Millisecond) }
+    time.Sleep(20 * time.Millisecond)
+    if n := clk.Timers(); n != 1 { t.Fatalf("%d timers after probing was turned off", n) }
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+    "github.com/gorilla/websocket"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestPoolStats(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(1, time.Minute, time.Minute, time.Minute)
+    ctx := context.Background()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    _, _, force, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    force()
+    fail := func() (*websocket.Conn, *http.Response, error) { return nil, nil, errors.New("refused") }
+    if _, _, _, err := p.Acquire(ctx, "k", fail); err == nil { t.Fatalf("expected dial failure") }
+    _, rel, _, err = p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    defer rel()
+
+    st := p.Stats()["k"]
+    if st.Open != 1 || st.Busy != 1 || st.Idle != 0 || st.Dials != 3 || st.DialFailures != 1 || st.Reuses != 1 || st.Evictions[fa.EvictForced] != 1 { t.Fatalf("stats %+v", st) }
+    var n int64
+    for _, c := range st.Wait.Counts { n += c }
+    if n != 4 { t.Fatalf("wait histogram %+v", st.Wait) }
+
+    rec := httptest.NewRecorder()
+    p.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+    var out map[string]fa.PoolKeyStats
+    if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil { t.Fatalf("json: %v", err) }
+    if out["k"].Dials != 3 || out["k"].Evictions[fa.EvictForced] != 1 { t.Fatalf("handler %s", rec.Body.String()) }
+}
+
+func TestPoolStatsEvictionReason(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(1, 20*time.Millisecond, time.Minute, time.Minute)
+    ctx := context.Background()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    time.Sleep(40 * time.Millisecond)
+    _, rel, _, err = p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    rel()
+    if st := p.Stats()["k"]; st.Evictions[fa.EvictIdleTTL] != 1 || st.Dials != 2 { t.Fatalf("stats %+v", st) }
+}
+
+func TestPoolIdleCountUnknownKey(t *testing.T) {
+    p := fa.NewWSConnPool(1, time.Minute, time.Minute, time.Minute)
+    if n := p.IdleCount("never-used"); n != 0 { t.Fatalf("idle %d", n) }
+    if st := p.Stats(); len(st) != 0 { t.Fatalf("IdleCount registered a key: %v", st) }
+}
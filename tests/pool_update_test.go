@@ -0,0 +1,92 @@
+package tests
+
+import (
+    "context"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func acquireAsync(p *fa.WSConnPool, key string, d *wsDialer) chan error {
+    done := make(chan error, 1)
+    go func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+        defer cancel()
+        _, rel, _, err := p.Acquire(ctx, key, d.dial)
+        if err == nil { defer rel() }
+        done <- err
+    }()
+    return done
+}
+
+func TestPoolUpdateGrowServesWaiters(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 1, MaxTotalConns: 1})
+    _, rel, _, err := p.Acquire(context.Background(), "a", d.dial)
+    if err != nil { t.Fatal(err) }
+    defer rel()
+    sameKey := acquireAsync(p, "a", d)
+    otherKey := acquireAsync(p, "b", d)
+    time.Sleep(30 * time.Millisecond)
+    cfg := p.Config()
+    cfg.MaxPerKey, cfg.MaxTotalConns = 2, 3
+    p.Update(cfg)
+    for _, ch := range []chan error{sameKey, otherKey} {
+        select {
+        case err := <-ch:
+            if err != nil { t.Fatal(err) }
+        case <-time.After(time.Second):
+            t.Fatalf("waiter not served after growing the pool")
+        }
+    }
+}
+
+func TestPoolUpdateShrinkDrains(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{MaxPerKey: 4})
+    ctx := context.Background()
+    if err := p.Warm(ctx, "k", 2, d.dial); err != nil { t.Fatal(err) }
+    _, rel1, _, _ := p.Acquire(ctx, "k", d.dial)
+    _, rel2, _, _ := p.Acquire(ctx, "k", d.dial)
+    _, rel3, _, _ := p.Acquire(ctx, "k", d.dial)
+    cfg := p.Config()
+    cfg.MaxPerKey = 1
+    p.Update(cfg)
+    if st := p.Stats()["k"]; st.Open != 3 || st.Idle != 0 { t.Fatalf("idle connection kept: %+v", st) }
+    rel1()
+    rel2()
+    rel3()
+    st := p.Stats()["k"]
+    if st.Open != 1 || st.Evictions[fa.EvictResize] != 2 { t.Fatalf("stats %+v", st) }
+}
+
+func TestPoolUpdateTTL(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPoolConfig(fa.PoolConfig{})
+    if err := p.Warm(context.Background(), "k", 1, d.dial); err != nil { t.Fatal(err) }
+    cfg := p.Config()
+    cfg.IdleTTL = time.Millisecond
+    p.Update(cfg)
+    time.Sleep(5 * time.Millisecond)
+    if n := p.IdleCount("k"); n != 0 { t.Fatalf("idle %d after lowering IdleTTL", n) }
+}
+
+func TestPoolRekeyOntoFullKey(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(1, time.Minute, time.Minute, time.Minute)
+    ctx := context.Background()
+    wsA, relA, _, err := p.Acquire(ctx, "a", d.dial)
+    if err != nil { t.Fatal(err) }
+    _, relB, _, err := p.Acquire(ctx, "b", d.dial)
+    if err != nil { t.Fatal(err) }
+    p.Rekey(wsA, "b")
+    relA()
+    st := p.Stats()["b"]
+    if st.Open != 1 || st.Evictions[fa.EvictRekey] != 1 || st.Evictions[fa.EvictResize] != 0 { t.Fatalf("stats %+v", st) }
+    relB()
+    wsC, relC, _, err := p.Acquire(ctx, "c", d.dial)
+    if err != nil { t.Fatal(err) }
+    p.Rekey(wsC, "a")
+    relC()
+    if n := p.IdleCount("a"); n != 1 { t.Fatalf("rekey onto a free key closed the socket: idle %d", n) }
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+    "context"
+    "math/rand"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+    "github.com/gorilla/websocket"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+// wsDialer serves websockets that stay open until the client closes them, or
+// until dropAll cuts them from the server side, and counts the dials made
+// through it.
+type wsDialer struct {
+    u     string
+    dials int32
+    mu    sync.Mutex
+    conns []*websocket.Conn
+}
+
+func newWSDialer(t *testing.T) *wsDialer {
+    up := websocket.Upgrader{}
+    d := &wsDialer{}
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        c, err := up.Upgrade(w, r, nil)
+        if err != nil { return }
+        defer c.Close()
+        d.mu.Lock()
+        d.conns = append(d.conns, c)
+        d.mu.Unlock()
+        for {
+            if _, _, err := c.ReadMessage(); err != nil { return }
+        }
+    }))
+    t.Cleanup(srv.Close)
+    d.u = "ws://" + srv.Listener.Addr().String()
+    return d
+}
+
+func (d *wsDialer) dropAll() {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    for _, c := range d.conns { _ = c.UnderlyingConn().Close() }
+    d.conns = nil
+}
+
+func (d *wsDialer) dial() (*websocket.Conn, *http.Response, error) {
+    atomic.AddInt32(&d.dials, 1)
+    return websocket.DefaultDialer.Dial(d.u, nil)
+}
+
+func TestPoolWaitersFIFOAndPriority(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(1, time.Minute, time.Minute, time.Minute)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    var mu sync.Mutex
+    var order []string
+    var wg sync.WaitGroup
+    start := func(name string, opts ...fa.AcquireOption) {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, r, _, err := p.Acquire(ctx, "k", d.dial, opts...)
+            if err != nil { t.Error(err); return }
+            mu.Lock()
+            order = append(order, name)
+            mu.Unlock()
+            r()
+        }()
+        time.Sleep(20 * time.Millisecond)
+    }
+    start("low1")
+    start("low2")
+    start("high", fa.AcquirePriority(1))
+    start("low3")
+    rel()
+    wg.Wait()
+    want := []string{"high", "low1", "low2", "low3"}
+    for i := range want {
+        if i >= len(order) || order[i] != want[i] { t.Fatalf("order %v, want %v", order, want) }
+    }
+    if n := atomic.LoadInt32(&d.dials); n != 1 { t.Fatalf("dialed %d sockets", n) }
+}
+
+func TestPoolAcquireDeadline(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(1, time.Minute, time.Minute, time.Minute)
+    ctx := context.Background()
+    _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    defer rel()
+    if _, _, _, err := p.Acquire(ctx, "k", d.dial, fa.AcquireDeadline(time.Now().Add(30*time.Millisecond))); err != fa.ErrAcquireTimeout { t.Fatalf("acquire: %v", err) }
+}
+
+func TestPoolCancellationChurn(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(2, time.Minute, time.Minute, time.Minute)
+    var wg sync.WaitGroup
+    var served int32
+    for i := 0; i < 300; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            r := rand.New(rand.NewSource(int64(i)))
+            ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.Intn(3000))*time.Microsecond)
+            defer cancel()
+            _, rel, force, err := p.Acquire(ctx, "k", d.dial, fa.AcquirePriority(r.Intn(3)))
+            if err != nil { return }
+            atomic.AddInt32(&served, 1)
+            time.Sleep(time.Duration(r.Intn(500)) * time.Microsecond)
+            if r.Intn(10) == 0 { force() } else { rel() }
+        }(i)
+    }
+    wg.Wait()
+    if atomic.LoadInt32(&served) == 0 { t.Fatalf("no acquire succeeded") }
+    // no connection may be stuck with a cancelled waiter: both slots are usable
+    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+    defer cancel()
+    _, rel1, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatalf("acquire after churn: %v", err) }
+    _, rel2, _, err := p.Acquire(ctx, "k", d.dial)
+    if err != nil { t.Fatalf("second acquire after churn: %v", err) }
+    rel1()
+    rel2()
+    if n := p.IdleCount("k"); n != 2 { t.Fatalf("idle %d", n) }
+}
+
+func TestPoolConcurrentDialsRespectLimit(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(2, time.Minute, time.Minute, time.Minute)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, rel, _, err := p.Acquire(ctx, "k", d.dial)
+            if err != nil { t.Error(err); return }
+            time.Sleep(time.Millisecond)
+            rel()
+        }()
+    }
+    wg.Wait()
+    if n := atomic.LoadInt32(&d.dials); n > 2 { t.Fatalf("dialed %d sockets for a limit of 2", n) }
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+    "context"
+    "sync/atomic"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+    "github.com/Helios-Orbit/H.D.D-audio/fishaudio/fishaudiotest"
+)
+
+func TestPoolWarm(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(3, time.Minute, time.Minute, time.Minute)
+    ctx := context.Background()
+    if err := p.Warm(ctx, "k", 5, d.dial); err != nil { t.Fatal(err) }
+    if n := p.IdleCount("k"); n != 3 { t.Fatalf("idle %d, want the key limit", n) }
+    if err := p.Warm(ctx, "k", 2, d.dial); err != nil { t.Fatal(err) }
+    if n := atomic.LoadInt32(&d.dials); n != 3 { t.Fatalf("dialed %d sockets", n) }
+}
+
+func TestPoolMinIdleRefills(t *testing.T) {
+    d := newWSDialer(t)
+    p := fa.NewWSConnPool(3, time.Minute, time.Minute, time.Minute)
+    p.SetMinIdle("k", 2, d.dial)
+    deadline := time.Now().Add(2 * time.Second)
+    for p.IdleCount("k") < 2 && time.Now().Before(deadline) { time.Sleep(5 * time.Millisecond) }
+    if n := p.IdleCount("k"); n != 2 { t.Fatalf("idle %d", n) }
+    _, _, force, err := p.Acquire(context.Background(), "k", d.dial)
+    if err != nil { t.Fatal(err) }
+    if n := atomic.LoadInt32(&d.dials); n != 2 { t.Fatalf("acquire dialed instead of reusing: %d", n) }
+    force()
+}
+
+func TestPoolMinIdleRefillsAfterReapFakeClock(t *testing.T) {
+    cases := []struct {
+        name   string
+        cfg    fa.PoolConfig
+        reason fa.EvictReason
+    }{
+        {"idle ttl", fa.PoolConfig{IdleTTL: time.Minute, MaxLife: time.Hour}, fa.EvictIdleTTL},
+        {"max life", fa.PoolConfig{IdleTTL: time.Hour, MaxLife: time.Minute}, fa.EvictMaxLife},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            d := newWSDialer(t)
+            clk := fishaudiotest.NewClock(time.Unix(1700000000, 0))
+            cfg := tc.cfg
+            cfg.MaxPerKey, cfg.TextIdleTTL, cfg.ReapInterval, cfg.Clock = 3, time.Hour, 10*time.Second, clk
+            p := fa.NewWSConnPoolConfig(cfg)
+            p.SetMinIdle("k", 2, d.dial)
+            waitFor := func(what string, ok func() bool) {
+                deadline := time.Now().Add(2 * time.Second)
+                for !ok() {
+                    if time.Now().After(deadline) { t.Fatalf("%s: %+v", what, p.Stats()["k"]) }
+                    time.Sleep(5 * time.Millisecond)
+                }
+            }
+            waitFor("warm", func() bool { return p.IdleCount("k") == 2 })
+            // the reaper is asleep
+            clk.BlockUntil(1)
+            clk.Advance(61 * time.Second)
+            waitFor("refill", func() bool {
+                st := p.Stats()["k"]
+                return st.Evictions[tc.reason] == 2 && st.Dials == 4 && p.IdleCount("k") == 2
+            })
+        })
+    }
+}
+
+func TestWarmRealtime(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := c.WarmRealtime(ctx, fa.TTSRequest{}, "s1", 1); err != nil { t.Fatal(err) }
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    defer conn.ForceClose()
+    if st := conn.Stats(); !st.Reused { t.Fatalf("session did not use the warm socket: %+v", st) }
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+    "context"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestRealtimeEventStream(t *testing.T) {
+    f := newFakeTTS(t)
+    f.onStart = []map[string]interface{}{
+        {"event": "log", "message": "warming up"},
+        {"event": "metrics", "rtf": 0.25},
+    }
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string, 2)
+    texts <- "one"
+    texts <- "two"
+    close(texts)
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    defer conn.Release()
+    var got []fa.Event
+    audio := 0
+    for ev := range conn.Events() {
+        got = append(got, ev)
+        switch e := ev.(type) {
+        case fa.AudioEvent:
+            audio++
+            if audio == 2 { _ = conn.Stop() }
+        case fa.UnknownEvent:
+            var m map[string]interface{}
+            if err := e.Decode(&m); err != nil { t.Fatalf("decode unknown: %v", err) }
+            if e.Name != "metrics" || m["rtf"] == nil { t.Fatalf("bad unknown event %+v", m) }
+        case fa.ErrorEvent:
+            t.Fatalf("session error: %v", e.Err)
+        }
+    }
+    if _, ok := got[0].(fa.OpenedEvent); !ok { t.Fatalf("first event %T", got[0]) }
+    if l, ok := got[1].(fa.ServerLogEvent); !ok || l.Message != "warming up" { t.Fatalf("second event %#v", got[1]) }
+    fin, ok := got[len(got)-1].(fa.FinishedEvent)
+    if !ok || fin.Reason != "stop" { t.Fatalf("last event %#v", got[len(got)-1]) }
+    select {
+    case <-conn.DoneCh():
+    default:
+        t.Fatalf("done not closed after events")
+    }
+}
+
+func TestRealtimeCancelEndsWithError(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    for i := 0; i < 50; i++ {
+        ctx, cancel := context.WithCancel(context.Background())
+        conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+        if err != nil { t.Fatalf("realtime: %v", err) }
+        cancel()
+        var last fa.Event
+        stats := false
+        for ev := range conn.Events() {
+            if _, ok := ev.(fa.StatsEvent); ok { stats = true }
+            last = ev
+        }
+        e, ok := last.(fa.ErrorEvent)
+        if !ok || e.Err != context.Canceled || !stats { t.Fatalf("run %d: last event %#v, stats %v", i, last, stats) }
+        conn.Release()
+    }
+}
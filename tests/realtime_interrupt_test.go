@@ -0,0 +1,50 @@
+package tests
+
+import (
+    "context"
+    "sync/atomic"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestRealtimeInterruptRestartsOnSameSocket(t *testing.T) {
+    f := newFakeTTS(t)
+    f.perFlush = 8
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    defer conn.Release()
+    id1, _ := conn.Send("first")
+    queued, _ := conn.Send("queued")
+    var id2 fa.UtteranceID
+    var cut *fa.InterruptedEvent
+    var lastOffset int64
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.AudioEvent:
+            if cut == nil {
+                lastOffset = e.ByteOffset + int64(len(e.Data))
+                if e.Utterance == id1 && e.ByteOffset == 0 {
+                    if err := conn.Interrupt(); err != nil { t.Fatalf("interrupt: %v", err) }
+                }
+                continue
+            }
+            if e.Utterance != id2 { t.Fatalf("audio of utterance %d after the cut", e.Utterance) }
+            _ = conn.Stop()
+        case fa.InterruptedEvent:
+            cut = &e
+            if id2, err = conn.Send("after"); err != nil { t.Fatalf("send: %v", err) }
+        case fa.ErrorEvent:
+            t.Fatalf("session error: %v", e.Err)
+        }
+    }
+    if cut == nil { t.Fatalf("no interrupt event") }
+    if cut.Utterance != id1 || cut.ByteOffset != lastOffset { t.Fatalf("bad cut %+v, last offset %d", cut, lastOffset) }
+    found := false
+    for _, id := range cut.Cancelled { if id == queued { found = true } }
+    if !found { t.Fatalf("queued utterance not cancelled: %v", cut.Cancelled) }
+    if n := atomic.LoadInt32(&f.conns); n != 1 { t.Fatalf("dialed %d sockets", n) }
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+    "context"
+    "errors"
+    "net"
+    "sync/atomic"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func runSession(t *testing.T, ctx context.Context, c *fa.Client, opts ...fa.RealtimeOption) {
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1", opts...)
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    conn.Send("hi")
+    conn.End()
+    if _, err := conn.Wait(ctx); err != nil { t.Fatal(err) }
+    conn.Release()
+}
+
+func TestRealtimeOptionsPooling(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    runSession(t, ctx, c, fa.WithoutPooling())
+    runSession(t, ctx, c, fa.WithoutPooling())
+    if n := atomic.LoadInt32(&f.conns); n != 2 { t.Fatalf("dialed %d sockets without pooling", n) }
+    runSession(t, ctx, c, fa.WithPoolKeySuffix("bulk"))
+    runSession(t, ctx, c)
+    runSession(t, ctx, c, fa.WithPoolKeySuffix("bulk"))
+    if n := atomic.LoadInt32(&f.conns); n != 4 { t.Fatalf("dialed %d sockets with a key suffix", n) }
+}
+
+func TestRealtimeReadTimeout(t *testing.T) {
+    f := newFakeTTS(t)
+    f.silentFlush = 1
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1", fa.WithReadTimeout(100*time.Millisecond), fa.WithAudioBuf(4))
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    time.Sleep(150 * time.Millisecond) // idle sessions have no read deadline
+    conn.Send("hi")
+    _, err = conn.Wait(ctx)
+    var ne net.Error
+    if !errors.As(err, &ne) || !ne.Timeout() { t.Fatalf("wait: %v", err) }
+    conn.ForceClose()
+}
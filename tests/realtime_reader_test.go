@@ -0,0 +1,47 @@
+package tests
+
+import (
+    "bytes"
+    "context"
+    "io"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestAudioReaderCopy(t *testing.T) {
+    f := newFakeTTS(t)
+    f.finishAfter = 3
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string, 3)
+    texts <- "a"
+    texts <- "b"
+    texts <- "c"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    r := conn.AudioReader()
+    defer r.Close()
+    var out bytes.Buffer
+    n, err := io.Copy(&out, r)
+    if err != nil { t.Fatalf("copy: %v", err) }
+    if n != int64(3*len(f.audio)) { t.Fatalf("copied %d bytes", n) }
+}
+
+func TestAudioReaderServerError(t *testing.T) {
+    f := newFakeTTS(t)
+    f.finishAfter = 1
+    f.finishReason = "error"
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string, 1)
+    texts <- "a"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    r := conn.AudioReader()
+    defer r.Close()
+    _, err = io.Copy(io.Discard, r)
+    if err == nil || err.Error() != "synthesis failed" { t.Fatalf("expected server error, got %v", err) }
+}
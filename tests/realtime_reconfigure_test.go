@@ -0,0 +1,45 @@
+package tests
+
+import (
+    "context"
+    "sync/atomic"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestRealtimeReconfigureSameSocket(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    a, b := "voice-a", "voice-b"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{ReferenceID: &a}, nil, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    first, _ := conn.Send("first")
+    reconfigured := make(chan error, 1)
+    var second fa.UtteranceID
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.AudioEvent:
+            if e.Utterance == first && e.ByteOffset == 0 {
+                go func() { reconfigured <- conn.Reconfigure(ctx, fa.TTSRequest{ReferenceID: &b}) }()
+                if err := <-reconfigured; err != nil { t.Fatalf("reconfigure: %v", err) }
+                second, _ = conn.Send("second")
+            } else if e.Utterance == second {
+                _ = conn.Stop()
+            }
+        case fa.FinishedEvent:
+            if second == 0 { t.Fatalf("session finished during reconfigure") }
+        case fa.ErrorEvent:
+            t.Fatalf("session error: %v", e.Err)
+        }
+    }
+    conn.Release()
+    starts := f.startRequests()
+    if len(starts) != 2 || starts[0]["reference_id"] != a || starts[1]["reference_id"] != b { t.Fatalf("start requests %v", starts) }
+    conn2, err := c.ConvertRealtime(ctx, fa.TTSRequest{ReferenceID: &b}, nil, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    conn2.ForceClose()
+    if n := atomic.LoadInt32(&f.conns); n != 1 { t.Fatalf("dialed %d sockets, want reuse under the new key", n) }
+}
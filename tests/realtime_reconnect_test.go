@@ -0,0 +1,119 @@
+package tests
+
+import (
+    "context"
+    "sync/atomic"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestRealtimeReconnectReplaysUnconfirmed(t *testing.T) {
+    f := newFakeTTS(t)
+    f.dropOnFlush = 2
+    c := f.client(t)
+    c.Options.ReconnectAttempts = 2
+    c.Options.UtteranceGap = 20 * time.Millisecond
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string, 2)
+    texts <- "first"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    defer conn.Release()
+    audio := 0
+    var rc *fa.ReconnectedEvent
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.AudioEvent:
+            audio++
+            if e.Replayed { t.Fatalf("unexpected replayed audio") }
+            if audio == 1 {
+                time.Sleep(100 * time.Millisecond)
+                texts <- "second"
+            } else {
+                _ = conn.Stop()
+            }
+        case fa.ReconnectedEvent:
+            rc = &e
+        case fa.ErrorEvent:
+            t.Fatalf("session error: %v", e.Err)
+        }
+    }
+    if rc == nil { t.Fatalf("no reconnect") }
+    if rc.Replayed != 1 { t.Fatalf("replayed %d texts, want 1", rc.Replayed) }
+    if audio != 2 { t.Fatalf("got %d audio chunks", audio) }
+}
+
+func TestRealtimeAbnormalCloseWithoutReconnect(t *testing.T) {
+    f := newFakeTTS(t)
+    f.dropOnFlush = 1
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string, 1)
+    texts <- "only"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    var last fa.Event
+    for ev := range conn.Events() { last = ev }
+    if _, ok := last.(fa.ErrorEvent); !ok { t.Fatalf("last event %#v", last) }
+}
+
+func TestRealtimeDropReplayedAudio(t *testing.T) {
+    f := newFakeTTS(t)
+    f.perFlush = 2
+    f.dropAfterFrames = 1
+    c := f.client(t)
+    c.Options.ReconnectAttempts = 2
+    c.Options.DropReplayedAudio = true
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    defer conn.Release()
+    id, _ := conn.Send("first")
+    starts := 0
+    var done *fa.UtteranceCompletedEvent
+    var delivered int64
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.AudioEvent:
+            if e.Replayed { t.Fatalf("replayed audio delivered") }
+            delivered += int64(len(e.Data))
+        case fa.UtteranceStartedEvent:
+            starts++
+        case fa.ReconnectedEvent:
+            _ = conn.End()
+        case fa.UtteranceCompletedEvent:
+            done = &e
+        case fa.ErrorEvent:
+            t.Fatalf("session error: %v", e.Err)
+        }
+    }
+    if starts != 1 || delivered != 320 { t.Fatalf("%d started events, %d bytes delivered", starts, delivered) }
+    // half the text was heard before the drop; the whole replay is discarded
+    if done == nil || done.ID != id || done.ByteOffset != 0 || done.ByteEnd != 320 || done.Discarded != 640 { t.Fatalf("completed %+v", done) }
+    if res, _ := conn.Wait(ctx); res.Utterances != 1 { t.Fatalf("result %+v", res) }
+}
+
+func TestRealtimeForceCloseDuringRedial(t *testing.T) {
+    f := newFakeTTS(t)
+    f.dropOnFlush = 1
+    f.redialDelay = 300 * time.Millisecond
+    c := f.client(t)
+    c.Options.ReconnectAttempts = 1
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    drain(conn)
+    conn.Send("one")
+    time.Sleep(100 * time.Millisecond)
+    conn.ForceClose()
+    deadline := time.Now().Add(2 * time.Second)
+    for atomic.LoadInt32(&f.closed) < 2 {
+        if time.Now().After(deadline) { t.Fatalf("redialed socket left open (%d of %d closed)", atomic.LoadInt32(&f.closed), atomic.LoadInt32(&f.conns)) }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+    "context"
+    "sync"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestRealtimeStopWhileSending(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    texts := make(chan string)
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, texts, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    var wg sync.WaitGroup
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 200; i++ {
+            select {
+            case texts <- "hello":
+            case <-conn.DoneCh():
+                return
+            }
+        }
+    }()
+    for i := 0; i < 4; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            time.Sleep(5 * time.Millisecond)
+            _ = conn.Stop()
+        }()
+    }
+    for ev := range conn.Events() {
+        if e, ok := ev.(fa.ErrorEvent); ok { t.Fatalf("session error: %v", e.Err) }
+    }
+    wg.Wait()
+    conn.Release()
+}
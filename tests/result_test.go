@@ -0,0 +1,103 @@
+package tests
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func drain(conn *fa.RealtimeConnection) { go func() { for range conn.Events() {} }() }
+
+func TestWaitResult(t *testing.T) {
+    f := newFakeTTS(t)
+    f.perFlush = 2
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    format, rate := "pcm", 16000
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{Format: &format, SampleRate: &rate}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    conn.Send("one")
+    conn.End()
+    res, err := conn.Wait(ctx)
+    if err != nil { t.Fatalf("wait: %v", err) }
+    // 640 bytes of 16-bit mono at 16kHz
+    if res.Reason != "stop" || res.Bytes != 640 || res.Duration != 20*time.Millisecond || res.Utterances != 1 { t.Fatalf("result %+v", res) }
+    conn.Release()
+}
+
+func TestWaitServerError(t *testing.T) {
+    f := newFakeTTS(t)
+    f.finishAfter = 1
+    f.finishReason = "error"
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    conn.Send("one")
+    res, err := conn.Wait(ctx)
+    var se *fa.ServerError
+    if !errors.As(err, &se) || se.Message != "synthesis failed" { t.Fatalf("wait error %v", err) }
+    // 320 bytes of mp3 at the default 128kbps
+    if res.Reason != "error" || res.Bytes != 320 || res.Duration != 20*time.Millisecond || res.Utterances != 0 { t.Fatalf("result %+v", res) }
+    conn.ForceClose()
+}
+
+func TestWaitContext(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    conn, err := c.ConvertRealtime(context.Background(), fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    defer conn.ForceClose()
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    if _, err := conn.Wait(ctx); err != context.DeadlineExceeded { t.Fatalf("wait: %v", err) }
+}
+
+func TestWaitUnansweredUtterance(t *testing.T) {
+    f := newFakeTTS(t)
+    f.silentFlush = 2
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    format := "wav"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{Format: &format}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    conn.Send("one")
+    conn.Send("two")
+    conn.End()
+    res, err := conn.Wait(ctx)
+    if err != nil { t.Fatalf("wait: %v", err) }
+    if res.Reason != "stop" || res.Utterances != 1 { t.Fatalf("result %+v", res) }
+    conn.Release()
+}
+
+func TestWaitResultBackToBack(t *testing.T) {
+    for _, format := range []string{"pcm", "wav"} {
+        t.Run(format, func(t *testing.T) {
+            f := newFakeTTS(t)
+            f.perFlush = 2
+            c := f.client(t)
+            ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+            defer cancel()
+            format, rate := format, 16000
+            conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{Format: &format, SampleRate: &rate}, nil, "s1")
+            if err != nil { t.Fatal(err) }
+            drain(conn)
+            conn.Send("one")
+            conn.Send("two")
+            conn.Send("three")
+            conn.End()
+            res, err := conn.Wait(ctx)
+            if err != nil { t.Fatalf("wait: %v", err) }
+            if res.Reason != "stop" || res.Bytes != 3*640 || res.Duration != 60*time.Millisecond || res.Utterances != 3 { t.Fatalf("result %+v", res) }
+            conn.Release()
+        })
+    }
+}
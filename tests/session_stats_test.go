@@ -0,0 +1,41 @@
+package tests
+
+import (
+    "context"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestSessionStats(t *testing.T) {
+    f := newFakeTTS(t)
+    f.perFlush = 3
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    for i := 0; i < 2; i++ {
+        conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+        if err != nil { t.Fatal(err) }
+        conn.Send("one")
+        conn.End()
+        var final *fa.SessionStats
+        sawFinished := false
+        for ev := range conn.Events() {
+            switch e := ev.(type) {
+            case fa.StatsEvent:
+                if sawFinished { t.Fatalf("stats after finish") }
+                final = &e.Stats
+            case fa.FinishedEvent:
+                sawFinished = true
+            }
+        }
+        if final == nil { t.Fatalf("no stats event") }
+        st := *final
+        if st.Reused != (i == 1) || (i == 0 && st.Dial <= 0) || (i == 1 && st.Dial != 0) || st.Acquire < st.Dial { t.Fatalf("session %d acquire stats %+v", i, st) }
+        if st.Chunks != 3 || st.Bytes != int64(3*len(f.audio)) || st.TimeToFirstAudio <= 0 { t.Fatalf("session %d stats %+v", i, st) }
+        if len(st.Flushes) != 1 || st.Flushes[0].Utterance != 1 || st.Flushes[0].FirstAudio <= 0 { t.Fatalf("flush latencies %+v", st.Flushes) }
+        if st.MaxChunkGap < st.MeanChunkGap { t.Fatalf("gaps %+v", st) }
+        if got := conn.Stats(); got.Chunks != st.Chunks { t.Fatalf("Stats() %+v", got) }
+        conn.Release()
+    }
+}
@@ -0,0 +1,36 @@
+package tests
+
+import (
+    "context"
+    "sync/atomic"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestSpeakReusesPooledSocket(t *testing.T) {
+    f := newFakeTTS(t)
+    f.perFlush = 3
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    for i := 0; i < 3; i++ {
+        audio, st, err := c.Speak(ctx, fa.TTSRequest{Text: "hello"}, "s1")
+        if err != nil { t.Fatalf("speak %d: %v", i, err) }
+        if len(audio) != 3*len(f.audio) || st.Bytes != len(audio) || st.Chunks != 3 { t.Fatalf("speak %d: %d bytes, stats %+v", i, len(audio), st) }
+        if st.FirstAudio <= 0 || st.Total < st.Connect { t.Fatalf("bad stats %+v", st) }
+    }
+    if n := atomic.LoadInt32(&f.conns); n != 1 { t.Fatalf("dialed %d sockets", n) }
+    starts := f.startRequests()
+    if len(starts) != 3 || starts[0]["text"] != "" { t.Fatalf("start requests %v", starts) }
+}
+
+func TestSpeakServerError(t *testing.T) {
+    f := newFakeTTS(t)
+    f.finishAfter = 1
+    f.finishReason = "error"
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if _, _, err := c.Speak(ctx, fa.TTSRequest{Text: "hello"}, "s1"); err == nil { t.Fatalf("expected error") }
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+    "context"
+    "errors"
+    "sync/atomic"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestStallFailsSession(t *testing.T) {
+    f := newFakeTTS(t)
+    f.silentFlush = 1
+    c := f.client(t)
+    c.Options.StallTimeout = 100 * time.Millisecond
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    id, _ := conn.Send("hello")
+    _, err = conn.Wait(ctx)
+    var se *fa.StallError
+    if !errors.As(err, &se) || se.Utterance != id || se.MidStream || se.Waited < c.Options.StallTimeout { t.Fatalf("wait: %v", err) }
+    if ctx.Err() != nil { t.Fatalf("stall not detected before the deadline") }
+    conn.ForceClose()
+}
+
+func TestStallRedials(t *testing.T) {
+    f := newFakeTTS(t)
+    f.silentFlush = 1
+    c := f.client(t)
+    c.Options.StallTimeout = 100 * time.Millisecond
+    c.Options.StallRedial = true
+    c.Options.ReconnectAttempts = 1
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    conn.Send("hello")
+    var stalls, audio int
+    var final error
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.StallEvent:
+            stalls++
+        case fa.AudioEvent:
+            audio += len(e.Data)
+            conn.End()
+        case fa.ErrorEvent:
+            final = e.Err
+        }
+    }
+    if final != nil || stalls != 1 || audio != len(f.audio) { t.Fatalf("stalls %d audio %d err %v", stalls, audio, final) }
+    if n := atomic.LoadInt32(&f.conns); n != 2 { t.Fatalf("dialed %d sockets", n) }
+    conn.Release()
+}
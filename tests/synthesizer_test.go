@@ -0,0 +1,44 @@
+package tests
+
+import (
+    "context"
+    "io"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func synthesize(t *testing.T, s *fa.Synthesizer, req fa.TTSRequest) ([]byte, fa.SynthResult) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    body, res, err := s.Synthesize(ctx, req, "s1")
+    if err != nil { t.Fatalf("synthesize: %v", err) }
+    defer body.Close()
+    b, err := io.ReadAll(body)
+    if err != nil { t.Fatalf("read: %v", err) }
+    return b, res
+}
+
+func TestSynthesizerPicksTransport(t *testing.T) {
+    f := newFakeTTS(t)
+    f.perFlush = 2
+    s := fa.NewSynthesizer(f.client(t))
+    balanced := "balanced"
+    b, res := synthesize(t, s, fa.TTSRequest{Text: "hi", Latency: &balanced})
+    if res.Transport != fa.TransportWebSocket || len(b) != 2*len(f.audio) { t.Fatalf("balanced: %+v, %d bytes", res, len(b)) }
+    b, res = synthesize(t, s, fa.TTSRequest{Text: "hi"})
+    if res.Transport != fa.TransportWebSocket || len(b) != 2*len(f.audio) { t.Fatalf("warm socket: %+v, %d bytes", res, len(b)) }
+    s.MaxWSChars = 1
+    b, res = synthesize(t, s, fa.TTSRequest{Text: "hi", Latency: &balanced})
+    if res.Transport != fa.TransportHTTP || string(b) != "http-audio" { t.Fatalf("long text: %+v, %q", res, b) }
+}
+
+func TestSynthesizerFallsBackToHTTP(t *testing.T) {
+    f := newFakeTTS(t)
+    f.failStart = true
+    s := fa.NewSynthesizer(f.client(t))
+    balanced := "balanced"
+    b, res := synthesize(t, s, fa.TTSRequest{Text: "hi", Latency: &balanced})
+    if res.Transport != fa.TransportHTTP || !res.Fallback || res.WSErr == nil { t.Fatalf("result %+v", res) }
+    if string(b) != "http-audio" { t.Fatalf("body %q", b) }
+}
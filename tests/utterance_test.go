@@ -0,0 +1,136 @@
+package tests
+
+import (
+    "context"
+    "testing"
+    "time"
+    fa "github.com/Helios-Orbit/H.D.D-audio/fishaudio"
+)
+
+func TestRealtimeUtteranceEvents(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    c.Options.UtteranceGap = 20 * time.Millisecond
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    format := "pcm"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{Format: &format}, nil, "s1")
+    if err != nil { t.Fatalf("realtime: %v", err) }
+    defer conn.Release()
+    id1, err := conn.Send("first")
+    if err != nil { t.Fatalf("send: %v", err) }
+    var id2 fa.UtteranceID
+    var started []fa.UtteranceStartedEvent
+    var completed []fa.UtteranceCompletedEvent
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.UtteranceStartedEvent:
+            started = append(started, e)
+        case fa.UtteranceCompletedEvent:
+            completed = append(completed, e)
+            if e.ID == id1 {
+                if id2, err = conn.Send("second"); err != nil { t.Fatalf("send: %v", err) }
+            } else {
+                _ = conn.Stop()
+            }
+        case fa.AudioEvent:
+            if e.Utterance == 0 { t.Fatalf("untagged audio") }
+        case fa.ErrorEvent:
+            t.Fatalf("session error: %v", e.Err)
+        }
+    }
+    if id1 == id2 { t.Fatalf("ids not unique") }
+    if len(started) != 2 || len(completed) != 2 { t.Fatalf("started %d completed %d", len(started), len(completed)) }
+    n := int64(len(f.audio))
+    if started[1].ID != id2 || started[1].ByteOffset != n || started[1].SampleOffset != n/2 { t.Fatalf("bad second start %+v", started[1]) }
+    if completed[1].ByteEnd != 2*n || completed[1].SampleEnd != n { t.Fatalf("bad second completion %+v", completed[1]) }
+}
+
+func TestSendAfterEnd(t *testing.T) {
+    f := newFakeTTS(t)
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    drain(conn)
+    conn.Send("before end")
+    if err := conn.End(); err != nil { t.Fatal(err) }
+    if _, err := conn.Send("after end"); err != fa.ErrSessionEnding { t.Fatalf("send after end: %v", err) }
+    if err := conn.End(); err != nil { t.Fatalf("second end: %v", err) }
+    res, err := conn.Wait(ctx)
+    if err != nil { t.Fatal(err) }
+    if res.Utterances != 1 { t.Fatalf("result %+v", res) }
+    if got := f.textEvents(); len(got) != 1 || got[0] != "before end" { t.Fatalf("server texts %q", got) }
+    if n := conn.TextCounts(); n.Queued != 10 || n.Confirmed != 10 { t.Fatalf("counts %+v", n) }
+    conn.Release()
+}
+
+func TestRealtimeUtterancesBackToBack(t *testing.T) {
+    f := newFakeTTS(t)
+    f.perFlush = 2
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    format := "wav"
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{Format: &format}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    var ids []fa.UtteranceID
+    for _, s := range []string{"one", "two", "three"} {
+        id, err := conn.Send(s)
+        if err != nil { t.Fatal(err) }
+        ids = append(ids, id)
+    }
+    conn.End()
+    var tags []fa.UtteranceID
+    var completed []fa.UtteranceCompletedEvent
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.AudioEvent:
+            tags = append(tags, e.Utterance)
+        case fa.UtteranceCompletedEvent:
+            completed = append(completed, e)
+        case fa.UtteranceUnconfirmedEvent:
+            t.Fatalf("unconfirmed %+v", e)
+        }
+    }
+    want := []fa.UtteranceID{ids[0], ids[0], ids[1], ids[1], ids[2], ids[2]}
+    if len(tags) != len(want) { t.Fatalf("tags %v", tags) }
+    for i := range want {
+        if tags[i] != want[i] { t.Fatalf("tags %v, want %v", tags, want) }
+    }
+    n := int64(2 * len(f.audio))
+    if len(completed) != 3 { t.Fatalf("completed %+v", completed) }
+    for i, e := range completed {
+        if e.ID != ids[i] || e.ByteOffset != int64(i)*n || e.ByteEnd != int64(i+1)*n || e.SampleEnd != int64(i+1)*n/2 || e.Inferred { t.Fatalf("completion %d: %+v", i, e) }
+    }
+    conn.Release()
+}
+
+func TestRealtimeUtterancesBackToBackInferred(t *testing.T) {
+    f := newFakeTTS(t)
+    f.perFlush = 2
+    c := f.client(t)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    conn, err := c.ConvertRealtime(ctx, fa.TTSRequest{}, nil, "s1")
+    if err != nil { t.Fatal(err) }
+    for _, s := range []string{"one", "two", "three"} {
+        if _, err := conn.Send(s); err != nil { t.Fatal(err) }
+    }
+    conn.End()
+    completed := 0
+    for ev := range conn.Events() {
+        switch e := ev.(type) {
+        case fa.UtteranceStartedEvent:
+            if !e.Inferred { t.Fatalf("mp3 start not inferred: %+v", e) }
+        case fa.UtteranceCompletedEvent:
+            if !e.Inferred { t.Fatalf("mp3 completion not inferred: %+v", e) }
+            completed++
+        case fa.UtteranceUnconfirmedEvent:
+            t.Fatalf("unconfirmed %+v", e)
+        }
+    }
+    if completed != 3 { t.Fatalf("completed %d", completed) }
+    conn.Release()
+}